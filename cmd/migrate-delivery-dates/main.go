@@ -0,0 +1,70 @@
+// Command migrate-delivery-dates rewrites orders whose delivery_date is still
+// the free-form string older releases stored. Strings that read as a date
+// become a BSON date; empty or unreadable ones are removed.
+//
+//	go run ./cmd/migrate-delivery-dates [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"the-book-store/db"
+	"the-book-store/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type legacyOrder struct {
+	ID           primitive.ObjectID `bson:"_id"`
+	DeliveryDate string             `bson:"delivery_date"`
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "print the converted dates without writing them")
+	flag.Parse()
+
+	db.Init()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	orders := db.DatabaseObj.Collection("order")
+	cur, err := orders.Find(ctx, bson.M{"delivery_date": bson.M{"$type": "string"}},
+		options.Find().SetProjection(bson.M{"delivery_date": 1}))
+	if err != nil {
+		log.Fatal(err)
+	}
+	var legacy []legacyOrder
+	if err := cur.All(ctx, &legacy); err != nil {
+		log.Fatal(err)
+	}
+
+	converted, cleared := 0, 0
+	for _, order := range legacy {
+		date, err := models.ParseDate(order.DeliveryDate)
+		var update bson.M
+		if err != nil || date.IsZero() {
+			fmt.Printf("%s: clearing %q\n", order.ID.Hex(), order.DeliveryDate)
+			update = bson.M{"$unset": bson.M{"delivery_date": ""}}
+			cleared++
+		} else {
+			fmt.Printf("%s: %q -> %s\n", order.ID.Hex(), order.DeliveryDate, date.Format("2006-01-02"))
+			update = bson.M{"$set": bson.M{"delivery_date": date.Time}}
+			converted++
+		}
+		if *dryRun {
+			continue
+		}
+		// only touch the order if nobody has set a real date in the meantime
+		_, err = orders.UpdateOne(ctx, bson.M{"_id": order.ID, "delivery_date": order.DeliveryDate}, update)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	fmt.Println("converted", converted, "delivery dates, cleared", cleared)
+}
@@ -0,0 +1,51 @@
+// Command migrate-review-votes prepares the review collections for votes and
+// reports. Reviews written before votes existed get helpful_count and
+// unhelpful_count of 0, which the helpful sort and its cursor rely on, and
+// review_vote and review_report get the unique (review, profile) indexes
+// that keep one vote and one report per buyer.
+//
+//	go run ./cmd/migrate-review-votes
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"the-book-store/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func main() {
+	db.Init()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	reviews := db.DatabaseObj.Collection("review")
+	for _, field := range []string{"helpful_count", "unhelpful_count"} {
+		result, err := reviews.UpdateMany(ctx,
+			bson.M{field: bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{field: 0}},
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("set", field, "on", result.ModifiedCount, "reviews")
+	}
+
+	for _, collection := range []string{"review_vote", "review_report"} {
+		name, err := db.DatabaseObj.Collection(collection).Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "review", Value: 1}, {Key: "profile", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		})
+		if err != nil {
+			// duplicates have to be removed by hand before the index can be built
+			log.Fatal(collection, ": ", err)
+		}
+		fmt.Println("created index", name, "on", collection)
+	}
+}
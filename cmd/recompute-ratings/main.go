@@ -0,0 +1,119 @@
+// Command recompute-ratings rebuilds every book's rating aggregates from the
+// review collection. Run it after a bad deploy or a manual data fix leaves
+// review_count, rating_total, the star counters or average_rating out of step.
+//
+//	go run ./cmd/recompute-ratings [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"the-book-store/db"
+	"the-book-store/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ratingStats struct {
+	Book  string `bson:"_id"`
+	Count int64  `bson:"count"`
+	Total int64  `bson:"total"`
+	Five  int64  `bson:"five"`
+	Four  int64  `bson:"four"`
+	Three int64  `bson:"three"`
+	Two   int64  `bson:"two"`
+	One   int64  `bson:"one"`
+}
+
+func starCount(stars int) bson.M {
+	return bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$stars", stars}}, 1, 0}}}
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "print the new aggregates without writing them")
+	flag.Parse()
+
+	db.Init()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	cur, err := db.DatabaseObj.Collection("review").Aggregate(ctx, bson.A{
+		// only published reviews count towards a book's rating
+		bson.M{"$match": bson.M{"status": bson.M{"$nin": models.UnpublishedReviewStatuses}}},
+		bson.M{"$group": bson.M{
+			"_id":   "$book",
+			"count": bson.M{"$sum": 1},
+			"total": bson.M{"$sum": "$stars"},
+			"five":  starCount(5),
+			"four":  starCount(4),
+			"three": starCount(3),
+			"two":   starCount(2),
+			"one":   starCount(1),
+		}},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	var stats []ratingStats
+	if err := cur.All(ctx, &stats); err != nil {
+		log.Fatal(err)
+	}
+
+	// books without any review left must be reset as well
+	reviewed := make([]primitive.ObjectID, 0, len(stats))
+	for _, s := range stats {
+		id, err := primitive.ObjectIDFromHex(s.Book)
+		if err != nil {
+			fmt.Println("SKIPPING REVIEWS FOR INVALID BOOK ID", s.Book)
+			continue
+		}
+		reviewed = append(reviewed, id)
+
+		average := 0.0
+		if s.Count > 0 {
+			average = math.Round(float64(s.Total)/float64(s.Count)*10) / 10
+		}
+		fmt.Printf("%s: %d reviews, average %.1f (5:%d 4:%d 3:%d 2:%d 1:%d)\n",
+			s.Book, s.Count, average, s.Five, s.Four, s.Three, s.Two, s.One)
+		if *dryRun {
+			continue
+		}
+		_, err = db.DatabaseObj.Collection("book").UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+			"review_count":   s.Count,
+			"rating_total":   s.Total,
+			"average_rating": average,
+			"five_star":      s.Five,
+			"four_star":      s.Four,
+			"three_star":     s.Three,
+			"two_star":       s.Two,
+			"one_star":       s.One,
+		}})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *dryRun {
+		return
+	}
+	result, err := db.DatabaseObj.Collection("book").UpdateMany(ctx, bson.M{"_id": bson.M{"$nin": reviewed}}, bson.M{"$set": bson.M{
+		"review_count":   0,
+		"rating_total":   0,
+		"average_rating": 0,
+		"five_star":      0,
+		"four_star":      0,
+		"three_star":     0,
+		"two_star":       0,
+		"one_star":       0,
+	}})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("updated", len(reviewed), "reviewed books, reset", result.ModifiedCount, "books without reviews")
+}
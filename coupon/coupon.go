@@ -0,0 +1,143 @@
+package coupon
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"the-book-store/models"
+)
+
+const (
+	TypePercentage = "PERCENTAGE"
+	TypeFlat       = "FLAT"
+)
+
+var (
+	ErrorCouponInactive      = "coupon is not active"
+	ErrorCouponNotStarted    = "coupon is not valid yet"
+	ErrorCouponExpired       = "coupon has expired"
+	ErrorCouponUsedUp        = "coupon has been fully redeemed"
+	ErrorCouponUserLimit     = "you have already used this coupon"
+	ErrorCouponMinOrder      = "order value is below the coupon minimum"
+	ErrorCouponNotApplicable = "coupon does not apply to these books"
+	ErrorInvalidCoupon       = "invalid coupon"
+)
+
+// Line is one item of the order a coupon is applied to.
+type Line struct {
+	Book     string
+	Seller   string
+	Category string
+	Amount   float64
+}
+
+// NormalizeCode makes coupon codes case insensitive.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Check validates the definition of a coupon before it is saved.
+func Check(c models.Coupon) error {
+	if c.Code == "" || c.Value <= 0 {
+		return errors.New(ErrorInvalidCoupon)
+	}
+	if c.DiscountType != TypePercentage && c.DiscountType != TypeFlat {
+		return errors.New(ErrorInvalidCoupon)
+	}
+	if c.DiscountType == TypePercentage && c.Value > 100 {
+		return errors.New(ErrorInvalidCoupon)
+	}
+	if !c.ValidUntil.IsZero() && c.ValidUntil.Before(c.ValidFrom) {
+		return errors.New(ErrorInvalidCoupon)
+	}
+	return nil
+}
+
+// Apply checks a coupon against the lines of an order and returns the
+// discount on every line along with the total discount. userRedemptions is
+// how many times the buyer has already used the coupon.
+func Apply(c models.Coupon, lines []Line, userRedemptions int64, now time.Time) ([]float64, float64, error) {
+	if !c.Active {
+		return nil, 0, errors.New(ErrorCouponInactive)
+	}
+	if !c.ValidFrom.IsZero() && now.Before(c.ValidFrom) {
+		return nil, 0, errors.New(ErrorCouponNotStarted)
+	}
+	if !c.ValidUntil.IsZero() && now.After(c.ValidUntil) {
+		return nil, 0, errors.New(ErrorCouponExpired)
+	}
+	if c.UsageLimit > 0 && c.UsedCount >= c.UsageLimit {
+		return nil, 0, errors.New(ErrorCouponUsedUp)
+	}
+	if c.PerUserLimit > 0 && userRedemptions >= c.PerUserLimit {
+		return nil, 0, errors.New(ErrorCouponUserLimit)
+	}
+
+	var eligibleTotal float64
+	eligible := make([]bool, len(lines))
+	for i, line := range lines {
+		if appliesTo(c, line) {
+			eligible[i] = true
+			eligibleTotal += line.Amount
+		}
+	}
+	if eligibleTotal == 0 {
+		return nil, 0, errors.New(ErrorCouponNotApplicable)
+	}
+	if eligibleTotal < c.MinOrderValue {
+		return nil, 0, errors.New(ErrorCouponMinOrder)
+	}
+
+	discount := c.Value
+	if c.DiscountType == TypePercentage {
+		discount = eligibleTotal * c.Value / 100
+		if c.MaxDiscount > 0 && discount > c.MaxDiscount {
+			discount = c.MaxDiscount
+		}
+	}
+	if discount > eligibleTotal {
+		discount = eligibleTotal
+	}
+	discount = round(discount)
+
+	// spread the discount over the eligible lines by value, the last one
+	// takes the rounding remainder
+	discounts := make([]float64, len(lines))
+	var assigned float64
+	last := -1
+	for i, line := range lines {
+		if !eligible[i] {
+			continue
+		}
+		discounts[i] = round(discount * line.Amount / eligibleTotal)
+		assigned += discounts[i]
+		last = i
+	}
+	discounts[last] = round(discounts[last] + discount - assigned)
+	return discounts, discount, nil
+}
+
+func appliesTo(c models.Coupon, line Line) bool {
+	if len(c.Categories) > 0 && !contains(c.Categories, line.Category) {
+		return false
+	}
+	if len(c.Sellers) > 0 && !contains(c.Sellers, line.Seller) {
+		return false
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -2,6 +2,7 @@ package dtos
 
 import (
 	"the-book-store/models"
+	"the-book-store/shipping"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -29,9 +30,147 @@ type Filters struct {
 }
 
 type Payment struct {
-	StripeToken  string         `json:"stripe_token,omitempty"`
-	TotalAmount  int64          `json:"total_amount,omitempty"`
-	Description  string         `json:"description,omitempty"`
-	ReceiptEmail string         `json:"receipt_email,omitempty"`
-	Orders       []models.Order `json:"orders,omitempty"`
+	StripeToken    string         `json:"stripe_token,omitempty"`
+	TotalAmount    int64          `json:"total_amount,omitempty"`
+	SubTotal       float64        `json:"sub_total,omitempty"`
+	ShippingAmount float64        `json:"shipping_amount,omitempty"`
+	TaxAmount      float64        `json:"tax_amount,omitempty"`
+	CouponCode     string         `json:"coupon_code,omitempty"`
+	Discount       float64        `json:"discount,omitempty"`
+	Description    string         `json:"description,omitempty"`
+	ReceiptEmail   string         `json:"receipt_email,omitempty"`
+	Orders         []models.Order `json:"orders,omitempty"`
+	// sent to Stripe so a retried checkout can't charge twice, never taken
+	// from the client
+	IdempotencyKey string `json:"-"`
+}
+
+// WishlistEntry is a wishlist item along with the book as it is now.
+type WishlistEntry struct {
+	Book         string    `json:"book,omitempty"`
+	AddedAt      time.Time `json:"added_at,omitempty"`
+	Title        string    `json:"title,omitempty"`
+	Author       string    `json:"author,omitempty"`
+	CoverImage   string    `json:"coverimage,omitempty"`
+	Price        float64   `json:"price,omitempty"`
+	SellingPrice float64   `json:"selling_price,omitempty"`
+	StocksLeft   int64     `json:"stocks_left"`
+	InStock      bool      `json:"in_stock"`
+	Available    bool      `json:"available"`
+}
+
+type QuoteItem struct {
+	Book     string `json:"book,omitempty"`
+	Quantity int64  `json:"quantity,omitempty"`
+}
+
+type CouponValidation struct {
+	Code    string      `json:"code,omitempty"`
+	Profile string      `json:"profile,omitempty"`
+	Items   []QuoteItem `json:"items,omitempty"`
+}
+
+type CouponResult struct {
+	Code     string  `json:"code,omitempty"`
+	SubTotal float64 `json:"sub_total"`
+	Discount float64 `json:"discount"`
+	Total    float64 `json:"total"`
+}
+
+type ShippingQuote struct {
+	Pincode   string              `json:"pincode,omitempty"`
+	Shipments []shipping.Shipment `json:"shipments"`
+	Total     float64             `json:"total"`
+}
+
+// ReviewStats summarises the reviews of one book.
+type ReviewStats struct {
+	Book      string  `json:"book,omitempty"`
+	Count     int64   `json:"count"`
+	Average   float64 `json:"average"`
+	FiveStar  int64   `bson:"five_star" json:"five_star"`
+	FourStar  int64   `bson:"four_star" json:"four_star"`
+	ThreeStar int64   `bson:"three_star" json:"three_star"`
+	TwoStar   int64   `bson:"two_star" json:"two_star"`
+	OneStar   int64   `bson:"one_star" json:"one_star"`
+}
+
+// ReviewQuery narrows and orders a book's review listing.
+type ReviewQuery struct {
+	Stars      []int32
+	WithImages bool
+	Sort       string
+	Cursor     string
+	Limit      int64
+}
+
+// UploadedImage is one stored image from an upload request.
+type UploadedImage struct {
+	FileName    string               `json:"file_name,omitempty"`
+	Key         string               `json:"key,omitempty"`
+	URL         string               `json:"url,omitempty"`
+	ContentType string               `json:"content_type,omitempty"`
+	Size        int64                `json:"size"`
+	Variants    models.ImageVariants `json:"variants"`
+}
+
+// UploadRequest asks for a link to upload one image for a book, review or
+// profile.
+type UploadRequest struct {
+	Purpose     string `json:"purpose,omitempty"`
+	Target      string `json:"target,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	// size of the file in bytes, the link only accepts exactly this many
+	Size int64 `json:"size,omitempty"`
+}
+
+// UploadTicket tells the client where to PUT the file, with which headers,
+// before it asks for the upload to be completed.
+type UploadTicket struct {
+	UploadId  string            `json:"upload_id,omitempty"`
+	URL       string            `json:"url,omitempty"`
+	Method    string            `json:"method,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at,omitempty"`
+}
+
+// BookImages is the body of the book image endpoints: the images to add or
+// their new order, or the image to use as cover.
+type BookImages struct {
+	Images []string `json:"images,omitempty"`
+	Image  string   `json:"image,omitempty"`
+}
+
+// SellerAnalytics sums up a seller's orders placed between From and To.
+// Money and units leave cancelled orders out; OrdersByStatus counts all.
+type SellerAnalytics struct {
+	Seller            string           `json:"seller,omitempty"`
+	From              string           `json:"from,omitempty"`
+	To                string           `json:"to,omitempty"`
+	Revenue           float64          `json:"revenue"`
+	Shipping          float64          `json:"shipping"`
+	Tax               float64          `json:"tax"`
+	Discount          float64          `json:"discount"`
+	UnitsSold         int64            `json:"units_sold"`
+	Orders            int64            `json:"orders"`
+	AverageOrderValue float64          `json:"average_order_value"`
+	OrdersByStatus    map[string]int64 `json:"orders_by_status"`
+	TopBooks          []BookSales      `json:"top_books"`
+	Daily             []SalesPoint     `json:"daily"`
+	Weekly            []SalesPoint     `json:"weekly"`
+}
+
+type BookSales struct {
+	Book    string  `bson:"_id" json:"book,omitempty"`
+	Title   string  `json:"title,omitempty"`
+	Units   int64   `json:"units"`
+	Revenue float64 `json:"revenue"`
+}
+
+// SalesPoint is one day ("2026-10-19") or ISO week ("2026-W42") of sales.
+type SalesPoint struct {
+	Period  string  `bson:"_id" json:"period,omitempty"`
+	Revenue float64 `json:"revenue"`
+	Units   int64   `json:"units"`
+	Orders  int64   `json:"orders"`
 }
@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"net/http"
 
@@ -9,13 +10,11 @@ import (
 
 var ErrorMethodNotAllowed = "method Not allowed"
 
+// NextCursorHeader carries the cursor of the next page on paginated lists.
+const NextCursorHeader = "X-Next-Cursor"
+
 func ApiResponse(status int, body interface{}) (*events.APIGatewayProxyResponse, error) {
-	resp := events.APIGatewayProxyResponse{Headers: map[string]string{
-		//"Content-Type":                 "application/json",
-		"Access-Control-Allow-Headers": "Content-Type,Authorization",
-		"Access-Control-Allow-Origin":  "*",
-		"Access-Control-Allow-Methods": "*",
-	}}
+	resp := events.APIGatewayProxyResponse{Headers: corsHeaders()}
 	resp.StatusCode = status
 
 	stringBody, _ := json.Marshal(body)
@@ -23,6 +22,35 @@ func ApiResponse(status int, body interface{}) (*events.APIGatewayProxyResponse,
 	return &resp, nil
 }
 
+// FileResponse sends a raw document (HTML, PDF...) instead of JSON. Binary
+// content is base64 encoded so API Gateway can convert it back on the way out.
+func FileResponse(status int, contentType string, fileName string, body []byte, binary bool) (*events.APIGatewayProxyResponse, error) {
+	resp := events.APIGatewayProxyResponse{Headers: corsHeaders()}
+	resp.StatusCode = status
+	resp.Headers["Content-Type"] = contentType
+	if fileName != "" {
+		resp.Headers["Content-Disposition"] = "inline; filename=\"" + fileName + "\""
+	}
+
+	if binary {
+		resp.Body = base64.StdEncoding.EncodeToString(body)
+		resp.IsBase64Encoded = true
+	} else {
+		resp.Body = string(body)
+	}
+	return &resp, nil
+}
+
 func UnhandledMethod() (*events.APIGatewayProxyResponse, error) {
 	return ApiResponse(http.StatusMethodNotAllowed, ErrorMethodNotAllowed)
 }
+
+func corsHeaders() map[string]string {
+	return map[string]string{
+		//"Content-Type":                 "application/json",
+		"Access-Control-Allow-Headers":  "Content-Type,Authorization,X-Profile-Id",
+		"Access-Control-Allow-Origin":   "*",
+		"Access-Control-Allow-Methods":  "*",
+		"Access-Control-Expose-Headers": NextCursorHeader,
+	}
+}
@@ -0,0 +1,45 @@
+package helpers
+
+import (
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// CallerProfileId returns the profile the request is made on behalf of. An
+// API Gateway authorizer puts it in its context as profileId. Without an
+// authorizer the X-Profile-Id header the frontend sends is used, which any
+// client can set: deployments relying on it for ownership or IsAdmin must
+// have the gateway or an authorizer overwrite that header.
+func CallerProfileId(req events.APIGatewayProxyRequest) string {
+	if profileId, ok := req.RequestContext.Authorizer["profileId"].(string); ok && profileId != "" {
+		return profileId
+	}
+	return Header(req, "X-Profile-Id")
+}
+
+// Header reads a request header. API Gateway may lower case header names so
+// the lookup ignores case.
+func Header(req events.APIGatewayProxyRequest, name string) string {
+	for key, value := range req.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// IsAdmin reports whether a profile is listed in ADMIN_PROFILE_IDS. It is
+// only as trustworthy as the profile id passed in, see CallerProfileId.
+func IsAdmin(profileId string) bool {
+	if profileId == "" {
+		return false
+	}
+	for _, admin := range strings.Split(os.Getenv("ADMIN_PROFILE_IDS"), ",") {
+		if strings.TrimSpace(admin) == profileId {
+			return true
+		}
+	}
+	return false
+}
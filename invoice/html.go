@@ -0,0 +1,58 @@
+package invoice
+
+import (
+	"bytes"
+	"html/template"
+
+	"the-book-store/models"
+)
+
+var htmlTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money": formatMoney,
+	"inc":   func(i int) int { return i + 1 },
+	"date":  func(inv models.Invoice) string { return inv.CreatedAt.Format("02 Jan 2006") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Tax Invoice {{.Number}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; font-size: 13px; margin: 32px; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #ccc; padding: 6px; text-align: left; }
+td.num, th.num { text-align: right; }
+.parties td { border: none; vertical-align: top; width: 50%; }
+</style>
+</head>
+<body>
+<h2>Tax Invoice</h2>
+<p>Invoice No: <b>{{.Number}}</b><br>Date: {{date .}}</p>
+<table class="parties">
+<tr>
+<td><b>Sold by</b><br>{{with .Seller}}{{.Name}}<br>{{.Address1}}<br>{{if .Address2}}{{.Address2}}<br>{{end}}{{.Pincode}}<br>{{if .Gstin}}GSTIN: {{.Gstin}}<br>{{end}}{{.Email}}{{end}}</td>
+<td><b>Billed to</b><br>{{with .Buyer}}{{.Name}}<br>{{.Address1}}<br>{{if .Address2}}{{.Address2}}<br>{{end}}{{.Pincode}}<br>{{.Phone}}<br>{{.Email}}{{end}}</td>
+</tr>
+</table>
+<br>
+<table>
+<tr><th>#</th><th>Item</th><th class="num">Qty</th><th class="num">Unit price</th><th class="num">Taxable value</th><th class="num">Tax</th><th class="num">Amount</th></tr>
+{{range $i, $item := .LineItems}}<tr><td>{{inc $i}}</td><td>{{$item.Title}}</td><td class="num">{{$item.Quantity}}</td><td class="num">{{money $item.UnitPrice}}</td><td class="num">{{money $item.TaxableValue}}</td><td class="num">{{money $item.TaxAmount}}</td><td class="num">{{money $item.Amount}}</td></tr>
+{{end}}</table>
+<br>
+<table>
+<tr><td>Sub total</td><td class="num">{{money .SubTotal}}</td></tr>
+{{range .Taxes}}<tr><td>{{.Name}} @ {{.Rate}}%</td><td class="num">{{money .Amount}}</td></tr>
+{{end}}<tr><td><b>Total</b></td><td class="num"><b>{{money .Total}}</b></td></tr>
+</table>
+</body>
+</html>
+`))
+
+// HTML renders the invoice as a standalone HTML page.
+func HTML(inv models.Invoice) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, inv); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
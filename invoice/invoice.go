@@ -0,0 +1,50 @@
+package invoice
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"the-book-store/models"
+)
+
+// Invoice numbers restart every Indian financial year (April to March),
+// e.g. BW/2026-27/000042.
+const numberPrefix = "BW"
+
+// FinancialYear returns the financial year label ("2026-27") a date falls in.
+func FinancialYear(t time.Time) string {
+	start := t.Year()
+	if t.Month() < time.April {
+		start--
+	}
+	return fmt.Sprintf("%d-%02d", start, (start+1)%100)
+}
+
+// Number formats the invoice number for a sequence within a financial year.
+func Number(financialYear string, sequence int64) string {
+	return fmt.Sprintf("%s/%s/%06d", numberPrefix, financialYear, sequence)
+}
+
+// Totals fills in the sub total, tax total, grand total and tax summary of
+// an invoice from its line items.
+func Totals(inv *models.Invoice) {
+	inv.SubTotal, inv.TaxTotal, inv.Total = 0, 0, 0
+	for _, item := range inv.LineItems {
+		inv.SubTotal += item.TaxableValue
+		inv.TaxTotal += item.TaxAmount
+		inv.Total += item.Amount
+	}
+	inv.SubTotal = Round(inv.SubTotal)
+	inv.TaxTotal = Round(inv.TaxTotal)
+	inv.Total = Round(inv.Total)
+}
+
+// Round rounds an amount to paise.
+func Round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+func formatMoney(amount float64) string {
+	return fmt.Sprintf("Rs. %.2f", amount)
+}
@@ -0,0 +1,138 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"the-book-store/models"
+)
+
+const (
+	pdfLinesPerPage = 60
+	pdfLineHeight   = 12
+	pdfTopMargin    = 800
+	pdfLeftMargin   = 40
+)
+
+// PDF renders the invoice as a plain single column PDF using the built in
+// Courier font, so no font files or external libraries are needed.
+func PDF(inv models.Invoice) ([]byte, error) {
+	return writePDF(textLines(inv))
+}
+
+func textLines(inv models.Invoice) []string {
+	lines := []string{
+		"TAX INVOICE",
+		"",
+		"Invoice No: " + inv.Number,
+		"Date:       " + inv.CreatedAt.Format("02 Jan 2006"),
+		"",
+		"Sold by:",
+	}
+	lines = append(lines, partyLines(inv.Seller, true)...)
+	lines = append(lines, "", "Billed to:")
+	lines = append(lines, partyLines(inv.Buyer, false)...)
+	lines = append(lines, "",
+		fmt.Sprintf("%-3s %-28s %4s %12s %12s %12s", "#", "Item", "Qty", "Taxable", "Tax", "Amount"),
+		strings.Repeat("-", 76),
+	)
+	for i, item := range inv.LineItems {
+		lines = append(lines, fmt.Sprintf("%-3d %-28s %4d %12.2f %12.2f %12.2f",
+			i+1, truncate(item.Title, 28), item.Quantity, item.TaxableValue, item.TaxAmount, item.Amount))
+	}
+	lines = append(lines, strings.Repeat("-", 76),
+		fmt.Sprintf("%-50s %25s", "Sub total", formatMoney(inv.SubTotal)))
+	for _, tax := range inv.Taxes {
+		lines = append(lines, fmt.Sprintf("%-50s %25s", fmt.Sprintf("%s @ %g%%", tax.Name, tax.Rate), formatMoney(tax.Amount)))
+	}
+	lines = append(lines, fmt.Sprintf("%-50s %25s", "Total", formatMoney(inv.Total)))
+	return lines
+}
+
+func partyLines(party models.InvoiceParty, seller bool) []string {
+	var lines []string
+	for _, line := range []string{party.Name, party.Address1, party.Address2, party.Pincode, party.Phone, party.Email} {
+		if line != "" {
+			lines = append(lines, "  "+line)
+		}
+	}
+	if seller && party.Gstin != "" {
+		lines = append(lines, "  GSTIN: "+party.Gstin)
+	}
+	return lines
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
+
+// writePDF lays the lines out top to bottom, starting a new page every
+// pdfLinesPerPage lines.
+func writePDF(lines []string) ([]byte, error) {
+	var pages [][]string
+	for len(lines) > pdfLinesPerPage {
+		pages = append(pages, lines[:pdfLinesPerPage])
+		lines = lines[pdfLinesPerPage:]
+	}
+	pages = append(pages, lines)
+
+	// objects 1: catalog, 2: page tree, 3: font, then a page and a content
+	// stream object for every page
+	var objects []string
+	objects = append(objects, "<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objects = append(objects, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>")
+	for i, page := range pages {
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT /F1 10 Tf %d TL %d %d Td\n", pdfLineHeight, pdfLeftMargin, pdfTopMargin)
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) '\n", escapePDF(line))
+		}
+		content.WriteString("ET")
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+		)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes(), nil
+}
+
+// escapePDF escapes a string for use inside a PDF literal string and drops
+// characters the standard Courier encoding cannot show.
+func escapePDF(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		default:
+			b.WriteRune('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+var ErrorInvalidDate = errors.New("date must look like 2026-10-19 or 2026-10-19T10:00:00+05:30")
+
+// Date is a date that older orders stored as a free-form string, "" when it
+// was not set. It reads those strings as well as BSON dates and always
+// writes a BSON date, or null when unset.
+type Date struct {
+	time.Time
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02",
+	"02/01/2006",
+	"02-01-2006",
+	"2 Jan 2006",
+	"January 2, 2006",
+}
+
+// ParseDate reads the date formats the frontend has sent over time.
+func ParseDate(value string) (Date, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Date{}, nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return Date{t}, nil
+		}
+	}
+	return Date{}, ErrorInvalidDate
+}
+
+func (d Date) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	if d.IsZero() {
+		return bsontype.Null, nil, nil
+	}
+	return bson.MarshalValue(d.Time)
+}
+
+// UnmarshalBSONValue never fails on a string: legacy values that can't be
+// read as a date are treated as unset rather than breaking the whole order.
+func (d *Date) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+	switch t {
+	case bsontype.DateTime:
+		d.Time = raw.Time()
+	case bsontype.String:
+		parsed, _ := ParseDate(raw.StringValue())
+		*d = parsed
+	default:
+		d.Time = time.Time{}
+	}
+	return nil
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte(`""`), nil
+	}
+	return d.Time.MarshalJSON()
+}
+
+// UnmarshalJSON takes the old string input but turns down text that isn't
+// a date, instead of storing it.
+func (d *Date) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*d = Date{}
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return ErrorInvalidDate
+	}
+	parsed, err := ParseDate(value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
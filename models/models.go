@@ -39,6 +39,7 @@ type Book struct {
 	ThreeStar       int64              `bson:"three_star" json:"three_star"`
 	TwoStar         int64              `bson:"two_star" json:"two_star"`
 	OneStar         int64              `bson:"one_star" json:"one_star"`
+	RatingTotal     int64              `bson:"rating_total" json:"-"`
 	InStock         bool               `bson:"in_stock" json:"in_stock,omitempty"`
 	CreatedAt       time.Time          `bson:"created_at" json:"created_at,omitempty"`
 	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at,omitempty"`
@@ -46,66 +47,291 @@ type Book struct {
 	Reviews         []string           `json:"review,omitempty"`
 	Images          []string           `json:"images,omitempty"`
 	CoverImage      string             `json:"coverimage,omitempty"`
+	ImageVariants   []ImageVariants    `bson:"image_variants" json:"image_variants,omitempty"`
+	CoverVariants   *ImageVariants     `bson:"cover_variants" json:"cover_variants,omitempty"`
 	PeopleBought    []string           `bson:"people_bought" json:"people_bought,omitempty"`
+	// only filled in on book detail responses for a given pincode
+	EstimatedDelivery *time.Time `bson:"-" json:"estimated_delivery,omitempty"`
 }
 
 type Profile struct {
+	ID                   primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	CognitoId            string             `bson:"cognito_id" json:"cognito_id,omitempty"`
+	Username             string             `json:"username,omitempty"`
+	Email                string             `json:"email,omitempty"`
+	ProfileImage         string             `bson:"profile_image" json:"profile_image,omitempty"`
+	ProfileImageVariants *ImageVariants     `bson:"profile_image_variants" json:"profile_image_variants,omitempty"`
+	Phone                string             `json:"phone,omitempty"`
+	Address1             string             `json:"address1,omitempty"`
+	Address2             string             `json:"address2,omitempty"`
+	Pincode              string             `json:"pincode,omitempty"`
+	State                string             `json:"state,omitempty"`
+	HandlingDays         int64              `bson:"handling_days" json:"handling_days,omitempty"`
+	Gstin                string             `bson:"gstin" json:"gstin,omitempty"`
+	CreatedAt            time.Time          `bson:"created_at" json:"created_at,omitempty"`
+	UpdatedAt            time.Time          `bson:"updated_at" json:"updated_at,omitempty"`
+	PostedBooks          []string           `json:"posted_books" json:"posted_books,omitempty"`
+	Orders               []string           `json:"orders,omitempty"`
+	OrdersWaiting        []string           `bson:"orders_waiting" json:"orders_waiting,omitempty"`
+	Cart                 []CartItem         `json:"cart,omitempty"`
+	Wishlist             []WishlistItem     `bson:"wishlist,omitempty" json:"wishlist,omitempty"`
+	// only filled in on GET profile/{profileId}
+	UnreadNotifications int64 `bson:"-" json:"unread_notifications"`
+}
+
+type WishlistItem struct {
+	Book    string    `json:"book,omitempty"`
+	AddedAt time.Time `bson:"added_at" json:"added_at,omitempty"`
+}
+
+type Order struct {
+	ID             primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	DeliveryDate   Date               `bson:"delivery_date" json:"delivery_date"`
+	Seller         string             `json:"seller,omitempty"`
+	Buyer          string             `json:"buyer,omitempty"`
+	Book           string             `json:"book,omitempty"`
+	Quantity       int64              `json:"quantity,omitempty"`
+	Amount         float64            `json:"amount,omitempty"`
+	ShippingCharge float64            `bson:"shipping_charge" json:"shipping_charge,omitempty"`
+	Discount       float64            `json:"discount,omitempty"`
+	Tax            TaxBreakdown       `json:"tax"`
+	Status         string             `json:"status,omitempty"`
+	Reviewed       bool               `json:"reviewed,omitempty"`
+	Invoiced       bool               `json:"invoiced,omitempty"`
+	BuyerName      string             `bson:"buyer_name" json:"buyer_name,omitempty"`
+	BuyerEmail     string             `bson:"buyer_email" json:"buyer_email,omitempty"`
+	Phone          string             `json:"phone,omitempty"`
+	Address1       string             `json:"address1,omitempty"`
+	Address2       string             `json:"address2,omitempty"`
+	Pincode        string             `json:"pincode,omitempty"`
+	State          string             `json:"state,omitempty"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at,omitempty"`
+	UpdatedAt      time.Time          `bson:"updated_at" json:"updated_at,omitempty"`
+}
+
+// TaxBreakdown is the GST contained in an order amount.
+type TaxBreakdown struct {
+	Class        string  `json:"class,omitempty"`
+	Rate         float64 `json:"rate"`
+	TaxableValue float64 `bson:"taxable_value" json:"taxable_value"`
+	CGST         float64 `bson:"cgst" json:"cgst"`
+	SGST         float64 `bson:"sgst" json:"sgst"`
+	IGST         float64 `bson:"igst" json:"igst"`
+	Total        float64 `json:"total"`
+}
+
+type Invoice struct {
+	ID            primitive.ObjectID  `json:"_id,omitempty" bson:"_id,omitempty"`
+	Number        string              `json:"number,omitempty"`
+	FinancialYear string              `bson:"financial_year" json:"financial_year,omitempty"`
+	Sequence      int64               `json:"sequence,omitempty"`
+	Orders        []string            `json:"orders,omitempty"`
+	Seller        InvoiceParty        `json:"seller,omitempty"`
+	Buyer         InvoiceParty        `json:"buyer,omitempty"`
+	LineItems     []InvoiceLineItem   `bson:"line_items" json:"line_items,omitempty"`
+	Taxes         []InvoiceTaxSummary `json:"taxes,omitempty"`
+	SubTotal      float64             `bson:"sub_total" json:"sub_total"`
+	TaxTotal      float64             `bson:"tax_total" json:"tax_total"`
+	Total         float64             `json:"total"`
+	CreatedAt     time.Time           `bson:"created_at" json:"created_at,omitempty"`
+}
+
+type InvoiceParty struct {
+	Profile  string `json:"profile,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+	Address1 string `json:"address1,omitempty"`
+	Address2 string `json:"address2,omitempty"`
+	Pincode  string `json:"pincode,omitempty"`
+	State    string `json:"state,omitempty"`
+	Gstin    string `json:"gstin,omitempty"`
+}
+
+type InvoiceLineItem struct {
+	Order        string  `json:"order,omitempty"`
+	Book         string  `json:"book,omitempty"`
+	Title        string  `json:"title,omitempty"`
+	Quantity     int64   `json:"quantity,omitempty"`
+	UnitPrice    float64 `bson:"unit_price" json:"unit_price"`
+	TaxableValue float64 `bson:"taxable_value" json:"taxable_value"`
+	TaxAmount    float64 `bson:"tax_amount" json:"tax_amount"`
+	Amount       float64 `json:"amount"`
+}
+
+type InvoiceTaxSummary struct {
+	Name   string  `json:"name,omitempty"`
+	Rate   float64 `json:"rate"`
+	Amount float64 `json:"amount"`
+}
+
+type Coupon struct {
 	ID            primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	CognitoId     string             `bson:"cognito_id" json:"cognito_id,omitempty"`
-	Username      string             `json:"username,omitempty"`
-	Email         string             `json:"email,omitempty"`
-	ProfileImage  string             `bson:"profile_image" json:"profile_image,omitempty"`
-	Phone         string             `json:"phone,omitempty"`
-	Address1      string             `json:"address1,omitempty"`
-	Address2      string             `json:"address2,omitempty"`
-	Pincode       string             `json:"pincode,omitempty"`
+	Code          string             `json:"code,omitempty"`
+	Description   string             `json:"description,omitempty"`
+	DiscountType  string             `bson:"discount_type" json:"discount_type,omitempty"`
+	Value         float64            `json:"value,omitempty"`
+	MaxDiscount   float64            `bson:"max_discount" json:"max_discount,omitempty"`
+	MinOrderValue float64            `bson:"min_order_value" json:"min_order_value,omitempty"`
+	UsageLimit    int64              `bson:"usage_limit" json:"usage_limit,omitempty"`
+	PerUserLimit  int64              `bson:"per_user_limit" json:"per_user_limit,omitempty"`
+	UsedCount     int64              `bson:"used_count" json:"used_count"`
+	ValidFrom     time.Time          `bson:"valid_from" json:"valid_from,omitempty"`
+	ValidUntil    time.Time          `bson:"valid_until" json:"valid_until,omitempty"`
+	Categories    []string           `json:"categories,omitempty"`
+	Sellers       []string           `json:"sellers,omitempty"`
+	Active        bool               `json:"active"`
 	CreatedAt     time.Time          `bson:"created_at" json:"created_at,omitempty"`
 	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at,omitempty"`
-	PostedBooks   []string           `json:"posted_books" json:"posted_books,omitempty"`
-	Orders        []string           `json:"orders,omitempty"`
-	OrdersWaiting []string           `bson:"orders_waiting" json:"orders_waiting,omitempty"`
-	Cart          []CartItem         `json:"cart,omitempty"`
 }
 
-type Order struct {
-	ID           primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	DeliveryDate string             `bson:"delivery_date" json:"delivery_date,omitempty"`
-	Seller       string             `json:"seller,omitempty"`
-	Buyer        string             `json:"buyer,omitempty"`
-	Book         string             `json:"book,omitempty"`
-	Quantity     int64              `json:"quantity,omitempty"`
-	Amount       float64            `json:"amount,omitempty"`
-	Status       string             `json:"status,omitempty"`
-	Reviewed     bool               `json:"reviewed,omitempty"`
-	BuyerName    string             `bson:"buyer_name" json:"buyer_name,omitempty"`
-	BuyerEmail   string             `bson:"buyer_email" json:"buyer_email,omitempty"`
-	Phone        string             `json:"phone,omitempty"`
-	Address1     string             `json:"address1,omitempty"`
-	Address2     string             `json:"address2,omitempty"`
-	Pincode      string             `json:"pincode,omitempty"`
-	CreatedAt    time.Time          `bson:"created_at" json:"created_at,omitempty"`
-	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at,omitempty"`
+type CouponRedemption struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Coupon    string             `json:"coupon,omitempty"`
+	Code      string             `json:"code,omitempty"`
+	Profile   string             `json:"profile,omitempty"`
+	Orders    []string           `json:"orders,omitempty"`
+	Discount  float64            `json:"discount"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at,omitempty"`
+}
+
+type Alert struct {
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Profile     string             `json:"profile,omitempty"`
+	Book        string             `json:"book,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	TargetPrice float64            `bson:"target_price" json:"target_price,omitempty"`
+	LastPrice   float64            `bson:"last_price" json:"last_price,omitempty"`
+	Active      bool               `json:"active"`
+	TriggeredAt time.Time          `bson:"triggered_at" json:"triggered_at,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at,omitempty"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at,omitempty"`
+}
+
+type Notification struct {
+	ID        primitive.ObjectID     `json:"_id,omitempty" bson:"_id,omitempty"`
+	Profile   string                 `json:"profile,omitempty"`
+	Type      string                 `json:"type,omitempty"`
+	Payload   map[string]interface{} `json:"payload,omitempty"`
+	Read      bool                   `json:"read"`
+	ReadAt    time.Time              `bson:"read_at" json:"read_at,omitempty"`
+	CreatedAt time.Time              `bson:"created_at" json:"created_at,omitempty"`
+	UpdatedAt time.Time              `bson:"updated_at" json:"updated_at,omitempty"`
 }
 
 type Review struct {
+	ID             primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Content        string             `json:"content,omitempty"`
+	Stars          int32              `json:"stars,omitempty"`
+	Images         []string           `json:"images,omitempty"`
+	ImageVariants  []ImageVariants    `bson:"image_variants" json:"image_variants,omitempty"`
+	Profile        string             `json:"profile,omitempty"`
+	Book           string             `json:"book,omitempty"`
+	Order          string             `json:"order,omitempty"`
+	Verified       bool               `json:"verified"`
+	HelpfulCount   int64              `bson:"helpful_count" json:"helpful_count"`
+	UnhelpfulCount int64              `bson:"unhelpful_count" json:"unhelpful_count"`
+	Status         string             `json:"status,omitempty"`
+	FlaggedReason  string             `bson:"flagged_reason" json:"flagged_reason,omitempty"`
+	ReportCount    int64              `bson:"report_count" json:"report_count,omitempty"`
+	ModeratedBy    string             `bson:"moderated_by" json:"moderated_by,omitempty"`
+	ModeratedAt    time.Time          `bson:"moderated_at" json:"moderated_at,omitempty"`
+	Reply          *ReviewReply       `json:"reply,omitempty"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at,omitempty"`
+	UpdatedAt      time.Time          `bson:"updated_at" json:"updated_at,omitempty"`
+}
+
+// Image is an uploaded image file and the resized copies made of it.
+type Image struct {
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Key         string             `json:"key,omitempty"`
+	URL         string             `json:"url,omitempty"`
+	ContentType string             `bson:"content_type" json:"content_type,omitempty"`
+	Size        int64              `json:"size"`
+	Profile     string             `json:"profile,omitempty"`
+	Variants    ImageVariants      `json:"variants"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at,omitempty"`
+}
+
+// Upload is a direct-to-storage upload, from the pre-signed link being
+// handed out until the file is checked and attached to its target.
+type Upload struct {
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Profile     string             `json:"profile,omitempty"`
+	Purpose     string             `json:"purpose,omitempty"`
+	Target      string             `json:"target,omitempty"`
+	Key         string             `json:"key,omitempty"`
+	ContentType string             `bson:"content_type" json:"content_type,omitempty"`
+	Size        int64              `json:"size,omitempty"`
+	Status      string             `json:"status,omitempty"`
+	URL         string             `json:"url,omitempty"`
+	ExpiresAt   time.Time          `bson:"expires_at" json:"expires_at,omitempty"`
+	CompletedAt time.Time          `bson:"completed_at" json:"completed_at,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at,omitempty"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at,omitempty"`
+}
+
+// ImageVariants are the URLs of an image at each size. Original is the URL
+// as stored on the book, review or profile.
+type ImageVariants struct {
+	Original string `json:"original,omitempty"`
+	Thumb    string `json:"thumb,omitempty"`
+	Card     string `json:"card,omitempty"`
+	Full     string `json:"full,omitempty"`
+}
+
+// ReviewReply is the seller's public answer to a review.
+type ReviewReply struct {
+	Profile   string    `json:"profile,omitempty"`
+	Content   string    `json:"content,omitempty"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at,omitempty"`
+}
+
+// ReviewReport is one profile's abuse report on a review.
+type ReviewReport struct {
 	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	Content   string             `json:"content,omitempty"`
-	Stars     int32              `json:"stars,omitempty"`
-	Images    []string           `json:"images,omitempty"`
+	Review    string             `json:"review,omitempty"`
 	Profile   string             `json:"profile,omitempty"`
-	Book      string             `json:"book,omitempty"`
+	Reason    string             `json:"reason,omitempty"`
+	Comment   string             `json:"comment,omitempty"`
+	Resolved  bool               `json:"resolved"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at,omitempty"`
+}
+
+// ReviewVote is one profile's helpful/unhelpful vote on a review.
+type ReviewVote struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Review    string             `json:"review,omitempty"`
+	Profile   string             `json:"profile,omitempty"`
+	Helpful   bool               `json:"helpful"`
 	CreatedAt time.Time          `bson:"created_at" json:"created_at,omitempty"`
 	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at,omitempty"`
 }
 
+// Cart is the API view of the items stored on Profile.Cart.
 type Cart struct {
 	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	Profile   *Profile           `json:"profile,omitempty"`
-	CartItems []*CartItem        `json:"cart_items" json:"cart_items,omitempty"`
+	Profile   string             `json:"profile,omitempty"`
+	CartItems []*CartItem        `bson:"cart_items" json:"cart_items"`
+	SubTotal  float64            `bson:"sub_total" json:"sub_total"`
+	Warnings  []CartWarning      `json:"warnings"`
 	CreatedAt time.Time          `bson:"created_at" json:"created_at,omitempty"`
 	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at,omitempty"`
 }
 
+// CartWarning tells the buyer that a book changed since it was put in the cart.
+type CartWarning struct {
+	Book      string  `json:"book,omitempty"`
+	Code      string  `json:"code,omitempty"`
+	Message   string  `json:"message,omitempty"`
+	OldAmount float64 `bson:"old_amount" json:"old_amount,omitempty"`
+	NewAmount float64 `bson:"new_amount" json:"new_amount,omitempty"`
+	Available int64   `json:"available"`
+}
+
+// CartItem.Amount is the unit selling price of the book when it was put in
+// the cart.
 type CartItem struct {
 	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
 	Book      string             `json:"book,omitempty"`
@@ -0,0 +1,13 @@
+package models
+
+// Statuses of a review. Reviews written before moderation existed have no
+// status and count as published.
+const (
+	ReviewStatusPending   = "PENDING"
+	ReviewStatusPublished = "PUBLISHED"
+	ReviewStatusHidden    = "HIDDEN"
+)
+
+// UnpublishedReviewStatuses are kept out of listings, stats and ratings,
+// wherever those are read.
+var UnpublishedReviewStatuses = []string{ReviewStatusPending, ReviewStatusHidden}
@@ -0,0 +1,31 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"the-book-store/db"
+	"the-book-store/models"
+)
+
+// ReviewReply only goes to the inbox, there is no email for it.
+const ReviewReply = "REVIEW_REPLY"
+
+// Store puts a notification in a profile's in-app inbox. Like Email it only
+// logs failures.
+func Store(profileId string, kind string, payload map[string]interface{}) {
+	if profileId == "" {
+		return
+	}
+	notification := models.Notification{
+		Profile:   profileId,
+		Type:      kind,
+		Payload:   payload,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if _, err := db.DatabaseObj.Collection("notification").InsertOne(context.Background(), notification); err != nil {
+		fmt.Println(err, "COULD NOT STORE NOTIFICATION", kind, profileId)
+	}
+}
@@ -0,0 +1,129 @@
+package notifications
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a rendered email ready to be sent.
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+var ErrorNoSender = errors.New("no email sender configured, set NOTIFY_SENDER to smtp or outbox")
+
+// Sender delivers emails. SMTPSender is used in production, OutboxSender
+// lets local runs inspect the mails instead of sending them.
+type Sender interface {
+	Send(msg Message) error
+}
+
+type SMTPSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s SMTPSender) Send(msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	return smtp.SendMail(s.Host+":"+s.Port, auth, s.From, msg.To, mimeMessage(s.From, msg))
+}
+
+// OutboxSender writes every email as an .eml file in Dir.
+type OutboxSender struct {
+	Dir  string
+	From string
+}
+
+func (s OutboxSender) Send(msg Message) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.Join(msg.To, "_"))
+	return ioutil.WriteFile(filepath.Join(s.Dir, name), mimeMessage(s.From, msg), 0644)
+}
+
+// unconfiguredSender refuses every email, so a deployment without sender
+// settings shows up as errors in the logs rather than mails quietly
+// written to a temp folder.
+type unconfiguredSender struct{}
+
+func (unconfiguredSender) Send(msg Message) error {
+	return ErrorNoSender
+}
+
+// headerValue keeps a value on its header line. Subjects carry book titles
+// sellers chose, and a line break in them would let them add headers.
+func headerValue(value string) string {
+	return strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(value)
+}
+
+func mimeMessage(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&buf, "To: %s\r\n", headerValue(strings.Join(msg.To, ", ")))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", headerValue(msg.Subject))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/html; charset=\"utf-8\"\r\n\r\n")
+	buf.WriteString(msg.Body)
+	return buf.Bytes()
+}
+
+var (
+	defaultSender Sender
+	defaultOnce   sync.Once
+)
+
+// DefaultSender picks the sender from the environment: NOTIFY_SENDER=smtp
+// sends through SMTP_HOST/SMTP_PORT/SMTP_USERNAME/SMTP_PASSWORD and
+// NOTIFY_SENDER=outbox, or just setting OUTBOX_DIR, writes to that folder.
+// Without either every send fails with ErrorNoSender.
+func DefaultSender() Sender {
+	defaultOnce.Do(func() {
+		from := os.Getenv("NOTIFY_FROM")
+		if from == "" {
+			from = "no-reply@bookworm.local"
+		}
+		sender := os.Getenv("NOTIFY_SENDER")
+		if sender == "smtp" && os.Getenv("SMTP_HOST") != "" {
+			port := os.Getenv("SMTP_PORT")
+			if port == "" {
+				port = "587"
+			}
+			defaultSender = SMTPSender{
+				Host:     os.Getenv("SMTP_HOST"),
+				Port:     port,
+				Username: os.Getenv("SMTP_USERNAME"),
+				Password: os.Getenv("SMTP_PASSWORD"),
+				From:     from,
+			}
+			return
+		}
+		dir := os.Getenv("OUTBOX_DIR")
+		if sender != "outbox" && dir == "" {
+			fmt.Println(ErrorNoSender, "NOTIFY_SENDER:", sender)
+			defaultSender = unconfiguredSender{}
+			return
+		}
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "outbox")
+		}
+		defaultSender = OutboxSender{Dir: dir, From: from}
+	})
+	return defaultSender
+}
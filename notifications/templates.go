@@ -0,0 +1,138 @@
+package notifications
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	texttemplate "text/template"
+	"time"
+)
+
+const (
+	OrderPlaced    = "ORDER_PLACED"
+	NewSale        = "NEW_SALE"
+	OrderShipped   = "ORDER_SHIPPED"
+	OrderDelivered = "ORDER_DELIVERED"
+	OrderCancelled = "ORDER_CANCELLED"
+	NewReview      = "NEW_REVIEW"
+)
+
+// OrderEmail is the data available to the order templates.
+type OrderEmail struct {
+	Name         string
+	OrderId      string
+	BookTitle    string
+	Quantity     int64
+	Amount       float64
+	BuyerName    string
+	Address      string
+	DeliveryDate time.Time
+}
+
+// ReviewEmail is the data available to the review template.
+type ReviewEmail struct {
+	Name      string
+	BookTitle string
+	Reviewer  string
+	Stars     int32
+	Content   string
+}
+
+type emailTemplate struct {
+	subject string
+	body    string
+}
+
+var emailTemplates = map[string]emailTemplate{
+	OrderPlaced: {
+		subject: "Your order for {{.BookTitle}} is confirmed",
+		body: `<p>Hi {{.Name}},</p>
+<p>Thanks for your order! We have received your order <b>{{.OrderId}}</b> for {{.Quantity}} x <b>{{.BookTitle}}</b> ({{money .Amount}}).</p>
+{{if not .DeliveryDate.IsZero}}<p>It should reach you by {{date .DeliveryDate}}.</p>{{end}}
+<p>Happy reading,<br>BookWorm</p>`,
+	},
+	NewSale: {
+		subject: "You sold {{.BookTitle}}",
+		body: `<p>Hi {{.Name}},</p>
+<p>{{.BuyerName}} just ordered {{.Quantity}} x <b>{{.BookTitle}}</b> ({{money .Amount}}). Order <b>{{.OrderId}}</b> is waiting for you to ship it to:</p>
+<p>{{.Address}}</p>
+<p>BookWorm</p>`,
+	},
+	OrderShipped: {
+		subject: "Your order for {{.BookTitle}} has shipped",
+		body: `<p>Hi {{.Name}},</p>
+<p>Good news, your order <b>{{.OrderId}}</b> for <b>{{.BookTitle}}</b> is on its way.</p>
+{{if not .DeliveryDate.IsZero}}<p>Expected delivery: {{date .DeliveryDate}}.</p>{{end}}
+<p>BookWorm</p>`,
+	},
+	OrderDelivered: {
+		subject: "Your order for {{.BookTitle}} was delivered",
+		body: `<p>Hi {{.Name}},</p>
+<p>Your order <b>{{.OrderId}}</b> for <b>{{.BookTitle}}</b> has been delivered. We hope you enjoy it, and would love to hear what you think in a review.</p>
+<p>BookWorm</p>`,
+	},
+	OrderCancelled: {
+		subject: "Your order for {{.BookTitle}} was cancelled",
+		body: `<p>Hi {{.Name}},</p>
+<p>Your order <b>{{.OrderId}}</b> for <b>{{.BookTitle}}</b> has been cancelled. Any amount charged will be refunded to your original payment method.</p>
+<p>BookWorm</p>`,
+	},
+	NewReview: {
+		subject: "New {{.Stars}} star review on {{.BookTitle}}",
+		body: `<p>Hi {{.Name}},</p>
+<p>{{.Reviewer}} left a {{.Stars}} star review on <b>{{.BookTitle}}</b>:</p>
+<blockquote>{{.Content}}</blockquote>
+<p>BookWorm</p>`,
+	},
+}
+
+var templateFuncs = template.FuncMap{
+	"money": func(amount float64) string { return fmt.Sprintf("Rs. %.2f", amount) },
+	"date":  func(t time.Time) string { return t.Format("Mon, 02 Jan 2006") },
+}
+
+// Render fills in the subject and body of an email template.
+func Render(kind string, data interface{}) (Message, error) {
+	tmpl, ok := emailTemplates[kind]
+	if !ok {
+		return Message{}, errors.New("unknown email template " + kind)
+	}
+	// the subject is a header, not HTML, so it must not be HTML escaped, but
+	// it must stay on one line
+	subject, err := texttemplate.New(kind + "-subject").Parse(tmpl.subject)
+	if err != nil {
+		return Message{}, err
+	}
+	body, err := template.New(kind + "-body").Funcs(templateFuncs).Parse(tmpl.body)
+	if err != nil {
+		return Message{}, err
+	}
+
+	var subjectBuf, bodyBuf bytes.Buffer
+	if err := subject.Execute(&subjectBuf, data); err != nil {
+		return Message{}, err
+	}
+	if err := body.Execute(&bodyBuf, data); err != nil {
+		return Message{}, err
+	}
+	return Message{Subject: headerValue(subjectBuf.String()), Body: bodyBuf.String()}, nil
+}
+
+// Email renders a template and sends it with the default sender. Failures
+// are logged and not returned: a lost email must never fail the request
+// that caused it.
+func Email(kind string, to string, data interface{}) {
+	if to == "" {
+		return
+	}
+	msg, err := Render(kind, data)
+	if err != nil {
+		fmt.Println(err, "COULD NOT RENDER EMAIL")
+		return
+	}
+	msg.To = []string{to}
+	if err := DefaultSender().Send(msg); err != nil {
+		fmt.Println(err, "COULD NOT SEND EMAIL", kind, to)
+	}
+}
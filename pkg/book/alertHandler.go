@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"the-book-store/db"
+	"the-book-store/helpers"
+	"the-book-store/models"
+	"the-book-store/notifications"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	AlertPriceDrop   = "PRICE_DROP"
+	AlertBackInStock = "BACK_IN_STOCK"
+)
+
+var (
+	ErrorMissingProfile = "missing X-Profile-Id header"
+	ErrorInvalidAlert   = "alert type must be PRICE_DROP or BACK_IN_STOCK"
+	ErrorAlertNotFound  = "alert not found"
+)
+
+// POST book/{bookId}/alert
+func CreateAlertHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := helpers.CallerProfileId(req)
+	if profileId == "" {
+		return helpers.ApiResponse(http.StatusUnauthorized, ErrorBody{
+			aws.String(ErrorMissingProfile),
+		})
+	}
+	var alert models.Alert
+	if err := json.Unmarshal([]byte(req.Body), &alert); err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	alert.Profile = profileId
+	alert.Book = req.PathParameters["bookId"]
+	err := CreateAlert(&alert)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusCreated, alert)
+}
+
+// DELETE book/{bookId}/alert?type=PRICE_DROP
+func DeleteAlertHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := helpers.CallerProfileId(req)
+	if profileId == "" {
+		return helpers.ApiResponse(http.StatusUnauthorized, ErrorBody{
+			aws.String(ErrorMissingProfile),
+		})
+	}
+	bookId := req.PathParameters["bookId"]
+	err := DeleteAlert(profileId, bookId, req.QueryStringParameters["type"])
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, bookId)
+}
+
+// CreateAlert subscribes a profile to a book. Subscribing again to the same
+// kind of alert replaces the previous subscription.
+func CreateAlert(alert *models.Alert) error {
+	if alert.Type != AlertPriceDrop && alert.Type != AlertBackInStock {
+		return errors.New(ErrorInvalidAlert)
+	}
+	var book models.Book
+	id, _ := primitive.ObjectIDFromHex(alert.Book)
+	err := db.DatabaseObj.Collection("book").FindOne(context.Background(), bson.M{"_id": id}).Decode(&book)
+	if err != nil {
+		return errors.New(ErrorFailedToFetchRecord)
+	}
+
+	alert.LastPrice = book.SellingPrice
+	alert.Active = true
+	alert.CreatedAt = time.Now()
+	alert.UpdatedAt = time.Now()
+	filter := bson.M{"profile": alert.Profile, "book": alert.Book, "type": alert.Type}
+	update := bson.M{"$set": bson.M{
+		"target_price": alert.TargetPrice,
+		"last_price":   alert.LastPrice,
+		"active":       true,
+		"updated_at":   alert.UpdatedAt,
+	}, "$setOnInsert": bson.M{"created_at": alert.CreatedAt}}
+	result, err := db.DatabaseObj.Collection("alert").UpdateOne(context.Background(), filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return errors.New(ErrorCouldNotUpdateItem)
+	}
+	if result.UpsertedID != nil {
+		alert.ID = result.UpsertedID.(primitive.ObjectID)
+	}
+	return nil
+}
+
+func DeleteAlert(profileId string, bookId string, alertType string) error {
+	filter := bson.M{"profile": profileId, "book": bookId}
+	if alertType != "" {
+		filter["type"] = alertType
+	}
+	d, err := db.DatabaseObj.Collection("alert").DeleteMany(context.Background(), filter)
+	if err != nil {
+		return errors.New(ErrorCouldNotDeleteItem)
+	}
+	if d.DeletedCount == 0 {
+		return errors.New(ErrorAlertNotFound)
+	}
+	return nil
+}
+
+// TriggerAlerts notifies the subscribers of a book after its price or stock
+// changed. Threshold and back in stock alerts fire once; "any drop" price
+// alerts stay active and remember the price they last fired at.
+func TriggerAlerts(previous models.Book, sellingPrice float64, inStock bool) {
+	if previous.ID.IsZero() {
+		return
+	}
+	bookId := previous.ID.Hex()
+	if sellingPrice > 0 && sellingPrice < previous.SellingPrice {
+		cur, err := db.DatabaseObj.Collection("alert").Find(context.Background(), bson.M{
+			"book":   bookId,
+			"type":   AlertPriceDrop,
+			"active": true,
+			"$or": bson.A{
+				bson.M{"target_price": bson.M{"$gte": sellingPrice}},
+				bson.M{"target_price": 0, "last_price": bson.M{"$gt": sellingPrice}},
+			},
+		})
+		if err == nil {
+			var alerts []models.Alert
+			cur.All(context.Background(), &alerts)
+			for _, alert := range alerts {
+				notifyAlert(alert, map[string]interface{}{
+					"book":      bookId,
+					"title":     previous.Title,
+					"old_price": alert.LastPrice,
+					"new_price": sellingPrice,
+				}, alert.TargetPrice == 0, sellingPrice)
+			}
+		}
+	}
+
+	if inStock && !previous.InStock {
+		cur, err := db.DatabaseObj.Collection("alert").Find(context.Background(), bson.M{
+			"book":   bookId,
+			"type":   AlertBackInStock,
+			"active": true,
+		})
+		if err == nil {
+			var alerts []models.Alert
+			cur.All(context.Background(), &alerts)
+			for _, alert := range alerts {
+				notifyAlert(alert, map[string]interface{}{
+					"book":  bookId,
+					"title": previous.Title,
+				}, false, sellingPrice)
+			}
+		}
+	}
+}
+
+func notifyAlert(alert models.Alert, payload map[string]interface{}, keepActive bool, price float64) {
+	notifications.Store(alert.Profile, alert.Type, payload)
+
+	update := bson.M{"$set": bson.M{
+		"active":       keepActive,
+		"last_price":   price,
+		"triggered_at": time.Now(),
+		"updated_at":   time.Now(),
+	}}
+	if _, err := db.DatabaseObj.Collection("alert").UpdateOne(context.Background(), bson.M{"_id": alert.ID}, update); err != nil {
+		fmt.Println(err, "COULD NOT UPDATE ALERT")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"reflect"
 	"strconv"
@@ -14,11 +15,12 @@ import (
 	"the-book-store/dtos"
 	"the-book-store/helpers"
 	"the-book-store/models"
+	"the-book-store/shipping"
+	"the-book-store/storage"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go/aws"
-	awslambda "github.com/grokify/go-awslambda"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -159,6 +161,11 @@ func GetBookHandler(req events.APIGatewayProxyRequest) (
 		})
 	}
 
+	if pincode := req.QueryStringParameters["pincode"]; shipping.ValidPincode(pincode) {
+		estimate := EstimateBookDelivery(book, pincode)
+		book.EstimatedDelivery = &estimate
+	}
+
 	return helpers.ApiResponse(http.StatusOK, book)
 }
 
@@ -238,7 +245,7 @@ func EditBookQuantityHandler(req events.APIGatewayProxyRequest) (
 	if err := json.Unmarshal([]byte(req.Body), &book); err != nil {
 		return nil, errors.New(ErrorInvalidData)
 	}
-	err := EditBookStatus(bookId, book)
+	err := EditBookQuantity(bookId, book)
 	if err != nil {
 		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
 			aws.String(err.Error()),
@@ -312,12 +319,12 @@ func SearchBooks(searchTerm string, categories []string, filters dtos.Filters) (
 			"title":         bson.M{"$regex": ".*" + searchTerm + ".*"},
 			"status":        "ACTIVE",
 			"category":      bson.M{"$in": categories},
-			"instock":       bson.M{"$in": filters.Stock},
-			"deliverytime":  bson.M{"$lt": filters.DeliveryTime},
-			"condition":     bson.M{"$in": filters.BookCondition},
-			"booktype":      bson.M{"$in": filters.BookType},
-			"averagerating": bson.M{"$gte": filters.Rating},
-			"sellingprice":  bson.M{"$gt": filters.MinPrice, "$lt": filters.MaxPrice},
+			"in_stock":       bson.M{"$in": filters.Stock},
+			"delivery_time":  bson.M{"$lt": filters.DeliveryTime},
+			"condition":      bson.M{"$in": filters.BookCondition},
+			"book_type":      bson.M{"$in": filters.BookType},
+			"average_rating": bson.M{"$gte": filters.Rating},
+			"selling_price":  bson.M{"$gt": filters.MinPrice, "$lt": filters.MaxPrice},
 		},
 		//bson.D{{"title", primitive.Regex{Pattern: "bh", Options: ""}}},
 	)
@@ -422,56 +429,92 @@ func GetBook(bookId string, book *models.Book) error {
 		return errors.New(ErrorFailedToFetchRecord)
 	}
 
-	reviewCount, err1 := GetAllReviewCount(bookId)
-	book.ReviewCount = reviewCount
-	reviewStars, err2 := GetStarReviewCount(bookId)
-	book.FiveStar = reviewStars["fiveStar"]
-	book.FourStar = reviewStars["fourStar"]
-	book.ThreeStar = reviewStars["threeStar"]
-	book.TwoStar = reviewStars["twoStar"]
-	book.OneStar = reviewStars["oneStar"]
-
-	if err1 != nil {
-		return errors.New(ErrorFailedToFetchRecord)
-	}
-
-	if err2 != nil {
-		return errors.New(ErrorFailedToFetchRecord)
+	stats, err := GetReviewStats(bookId)
+	if err != nil {
+		return err
 	}
+	book.ReviewCount = stats.Count
+	book.AverageRating = stats.Average
+	book.FiveStar = stats.FiveStar
+	book.FourStar = stats.FourStar
+	book.ThreeStar = stats.ThreeStar
+	book.TwoStar = stats.TwoStar
+	book.OneStar = stats.OneStar
 
 	fmt.Println("book", book)
 	return err
 }
 
-func GetAllReviewCount(bookId string) (int64, error) {
-	itemCount, err := db.DatabaseObj.Collection("review").CountDocuments(context.Background(), bson.M{"book": bookId})
+// EstimateBookDelivery tells a buyer when the book would reach their pincode
+// if they ordered it now.
+func EstimateBookDelivery(book models.Book, pincode string) time.Time {
+	var seller models.Profile
+	GetProfile(book.Profile, &seller)
+	zone := shipping.Zone(seller.Pincode, pincode)
+	return shipping.EstimateDelivery(time.Now(), seller.HandlingDays, book.DeliveryTime, zone)
+}
+
+func GetProfile(profileId string, profile *models.Profile) error {
+	id, _ := primitive.ObjectIDFromHex(profileId)
+	fmt.Println("Object id", id, profileId)
 
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := db.DatabaseObj.Collection("profile").FindOne(ctx, bson.M{"_id": id}).Decode(profile)
 	if err != nil {
-		return 0, errors.New(ErrorFailedToFetchRecord)
+		return errors.New(ErrorFailedToFetchRecord)
 	}
-	fmt.Println(itemCount, reflect.TypeOf(itemCount))
-
-	//GetStarReviewCount(bookId)
+	return nil
+}
 
-	return itemCount, nil
+func starCount(stars int32) bson.M {
+	return bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$stars", stars}}, 1, 0}}}
 }
 
-func GetStarReviewCount(bookId string) (map[string]int64, error) {
-	fiveStar, err1 := db.DatabaseObj.Collection("review").CountDocuments(context.Background(), bson.M{"stars": 5, "book": bookId})
-	fourStar, err2 := db.DatabaseObj.Collection("review").CountDocuments(context.Background(), bson.M{"stars": 4, "book": bookId})
-	threeStar, err3 := db.DatabaseObj.Collection("review").CountDocuments(context.Background(), bson.M{"stars": 3, "book": bookId})
-	twoStar, err4 := db.DatabaseObj.Collection("review").CountDocuments(context.Background(), bson.M{"stars": 2, "book": bookId})
-	oneStar, err5 := db.DatabaseObj.Collection("review").CountDocuments(context.Background(), bson.M{"stars": 1, "book": bookId})
+// GetReviewStats counts, averages and buckets a book's reviews in a single
+// aggregation.
+func GetReviewStats(bookId string) (dtos.ReviewStats, error) {
+	stats := dtos.ReviewStats{Book: bookId}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cur, err := db.DatabaseObj.Collection("review").Aggregate(ctx, bson.A{
+		// held and hidden reviews don't count, see the review lambda
+		bson.M{"$match": bson.M{"book": bookId, "status": bson.M{"$nin": models.UnpublishedReviewStatuses}}},
+		bson.M{"$group": bson.M{
+			"_id":        nil,
+			"count":      bson.M{"$sum": 1},
+			"average":    bson.M{"$avg": "$stars"},
+			"five_star":  starCount(5),
+			"four_star":  starCount(4),
+			"three_star": starCount(3),
+			"two_star":   starCount(2),
+			"one_star":   starCount(1),
+		}},
+	})
+	if err != nil {
+		return stats, errors.New(ErrorFailedToFetchRecord)
+	}
+	defer cur.Close(ctx)
 
-	fmt.Println(fiveStar, fourStar, threeStar, twoStar, oneStar)
-	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil {
-		return nil, errors.New(ErrorFailedToFetchRecord)
+	if cur.Next(ctx) {
+		if err := cur.Decode(&stats); err != nil {
+			return stats, errors.New(ErrorFailedToFetchRecord)
+		}
 	}
-	return map[string]int64{"fiveStar": fiveStar, "fourStar": fourStar, "threeStar": threeStar, "twoStar": twoStar, "oneStar": oneStar}, nil
+	stats.Book = bookId
+	stats.Average = math.Round(stats.Average*10) / 10
+	return stats, nil
 }
 
 // Insert one book in the DB
 func CreateBook(book *models.Book) error {
+	cover, err := CheckBookImages(book.Profile, book.Images, book.CoverImage)
+	if err != nil {
+		return err
+	}
+	book.CoverImage = cover
+	book.ImageVariants = storage.VariantsFor(book.Images)
+	book.CoverVariants = storage.VariantsOf(book.CoverImage)
 	book.CreatedAt = time.Now()
 	book.UpdatedAt = time.Now()
 	insertResult, err := db.DatabaseObj.Collection("book").InsertOne(context.Background(), book)
@@ -491,6 +534,8 @@ func UpdateBook(bookId string, book models.Book) error {
 	fmt.Println(book)
 	id, _ := primitive.ObjectIDFromHex(bookId)
 	filter := bson.M{"_id": id}
+	var previous models.Book
+	db.DatabaseObj.Collection("book").FindOne(context.Background(), filter).Decode(&previous)
 	update := bson.M{"$set": bson.M{
 		"title":             book.Title,
 		"price":             book.Price,
@@ -506,11 +551,11 @@ func UpdateBook(bookId string, book models.Book) error {
 		"condition":         book.Condition,
 		"publisher":         book.Publisher,
 		"stocks_left":       book.StocksLeft,
+		"in_stock":          book.StocksLeft > 0,
 		"delivery_time":     book.DeliveryTime,
 		"country_of_origin": book.CountryOfOrigin,
 		"language":          book.Language,
-		"coverimage":        book.CoverImage,
-		"images":            book.Images,
+		// images and cover are managed through book/{bookId}/images
 	}}
 	result, err := db.DatabaseObj.Collection("book").UpdateOne(context.Background(), filter, update)
 	if err != nil {
@@ -518,6 +563,7 @@ func UpdateBook(bookId string, book models.Book) error {
 	}
 
 	fmt.Println("modified count: ", result.ModifiedCount)
+	TriggerAlerts(previous, book.SellingPrice, book.StocksLeft > 0)
 	return nil
 }
 
@@ -541,8 +587,11 @@ func EditBookQuantity(bookId string, book models.Book) error {
 	fmt.Println(book)
 	id, _ := primitive.ObjectIDFromHex(bookId)
 	filter := bson.M{"_id": id}
+	var previous models.Book
+	db.DatabaseObj.Collection("book").FindOne(context.Background(), filter).Decode(&previous)
 	update := bson.M{"$set": bson.M{
-		"stocksleft":    book.StocksLeft,
+		"stocks_left":   book.StocksLeft,
+		"in_stock":      book.StocksLeft > 0,
 		"delivery_time": book.DeliveryTime,
 	}}
 	result, err := db.DatabaseObj.Collection("book").UpdateOne(context.Background(), filter, update)
@@ -551,6 +600,7 @@ func EditBookQuantity(bookId string, book models.Book) error {
 	}
 
 	fmt.Println("modified count: ", result.ModifiedCount)
+	TriggerAlerts(previous, previous.SellingPrice, book.StocksLeft > 0)
 	return nil
 }
 
@@ -596,35 +646,3 @@ func DeleteAllBooks() (int64, error) {
 	fmt.Println("Deleted Document", d.DeletedCount)
 	return d.DeletedCount, nil
 }
-
-func HandleImageUpload(req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
-	//res := events.APIGatewayProxyResponse{}
-	fmt.Println("HELLO I`M INSIDE HANDLE IMAGE UPLOAD FUNCTION")
-	r, err := awslambda.NewReaderMultipart(req)
-	if err != nil {
-		fmt.Println(err, "ERROR PRINTING")
-		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
-			aws.String(err.Error()),
-		})
-	}
-	s, _ := json.MarshalIndent(r, "", "\t")
-	fmt.Print(string(s), "PRINTING R NEW READER MULTIPART", r)
-	fmt.Printf("%#v\n", r)
-	fmt.Println()
-
-	part, err := r.NextPart()
-	fmt.Println(part, reflect.TypeOf(part), "PRINTING R.NEXTPART()")
-	fmt.Printf("%#v\n", part)
-	if err != nil {
-		fmt.Println(err, "ERROR PRINTING PART")
-	}
-	/*
-		content, err := ioutil.ReadAll(part)
-		if err != nil {
-			return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
-				aws.String(err.Error()),
-			})
-		}
-	*/
-	return helpers.ApiResponse(http.StatusOK, "IMAGE READ SUCCESSFUL")
-}
@@ -31,6 +31,10 @@ func MatchRouteBook(req events.APIGatewayProxyRequest) (*events.APIGatewayProxyR
 			return CreateBookHandler(req)
 		} else if req.Resource == "/book/uploadimage" {
 			return HandleImageUpload(req)
+		} else if req.Resource == "/book/{bookId}/alert" {
+			return CreateAlertHandler(req)
+		} else if req.Resource == "/book/{bookId}/images" {
+			return AddBookImagesHandler(req)
 		} else {
 			return helpers.UnhandledMethod()
 		}
@@ -41,11 +45,21 @@ func MatchRouteBook(req events.APIGatewayProxyRequest) (*events.APIGatewayProxyR
 			return EditBookStatusHandler(req)
 		} else if req.Resource == "/book/{bookId}/editQuantity" {
 			return EditBookQuantityHandler(req)
+		} else if req.Resource == "/book/{bookId}/images" {
+			return ReorderBookImagesHandler(req)
+		} else if req.Resource == "/book/{bookId}/cover" {
+			return SetBookCoverHandler(req)
 		} else {
 			return helpers.UnhandledMethod()
 		}
 	case "DELETE":
-		return DeleteBookHandler(req)
+		if req.Resource == "/book/{bookId}/alert" {
+			return DeleteAlertHandler(req)
+		} else if req.Resource == "/book/{bookId}/images" {
+			return DeleteBookImageHandler(req)
+		} else {
+			return DeleteBookHandler(req)
+		}
 	default:
 		fmt.Println("Exiting handler")
 		return helpers.UnhandledMethod()
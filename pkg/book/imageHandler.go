@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"the-book-store/db"
+	"the-book-store/dtos"
+	"the-book-store/helpers"
+	"the-book-store/models"
+	"the-book-store/storage"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	awslambda "github.com/grokify/go-awslambda"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	ErrorNoImages       = "no image files in the upload"
+	ErrorTooManyImages  = "too many images in one upload"
+	ErrorCouldNotUpload = "could not store image"
+)
+
+// POST book/uploadimage
+// Takes multipart/form-data with one or more image files and returns where
+// each was stored, ready to be used in images/coverimage, along with the
+// URLs of its thumb/card/full sizes.
+func HandleImageUpload(req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	fmt.Println("HELLO I`M INSIDE HANDLE IMAGE UPLOAD FUNCTION")
+	uploaded, err := UploadImages(req, "book", helpers.CallerProfileId(req))
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusCreated, uploaded)
+}
+
+// UploadImages stores every file part of a multipart request. All files are
+// read and checked before any is stored, so a bad file rejects the whole
+// upload instead of leaving half of it behind.
+func UploadImages(req events.APIGatewayProxyRequest, folder string, owner string) ([]dtos.UploadedImage, error) {
+	r, err := awslambda.NewReaderMultipart(req)
+	if err != nil {
+		return nil, err
+	}
+
+	type file struct {
+		name        string
+		contentType string
+		body        []byte
+	}
+	var files []file
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// plain form fields have no file name
+		if part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		if len(files) == storage.MaxImagesPerUpload {
+			return nil, errors.New(ErrorTooManyImages)
+		}
+		// read one byte past the limit so oversized files are caught
+		body, err := ioutil.ReadAll(io.LimitReader(part, storage.MaxImageSize+1))
+		part.Close()
+		if err != nil {
+			return nil, err
+		}
+		contentType, err := storage.SniffImage(body)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", part.FileName(), err)
+		}
+		files = append(files, file{part.FileName(), contentType, body})
+	}
+	if len(files) == 0 {
+		return nil, errors.New(ErrorNoImages)
+	}
+
+	store := storage.DefaultStore()
+	var uploaded []dtos.UploadedImage
+	for _, f := range files {
+		key := storage.ImageKey(folder, owner, f.contentType)
+		image, err := storage.RecordImage(store, key, owner, f.contentType, f.body)
+		if err != nil {
+			fmt.Println(err, "COULD NOT STORE IMAGE", key)
+			for _, done := range uploaded {
+				store.Delete(done.Key)
+				storage.DeleteVariants(store, done.Key)
+			}
+			return nil, errors.New(ErrorCouldNotUpload)
+		}
+		uploaded = append(uploaded, dtos.UploadedImage{
+			FileName:    f.name,
+			Key:         key,
+			URL:         image.URL,
+			ContentType: f.contentType,
+			Size:        image.Size,
+			Variants:    image.Variants,
+		})
+	}
+	return uploaded, nil
+}
+
+var (
+	ErrorNotBookOwner       = "only the seller of the book can change its images"
+	ErrorUnknownImage       = "images must be uploaded through book/uploadimage or upload/request first"
+	ErrorImageNotOwned      = "images must be uploaded by the seller of the book"
+	ErrorImageNotOnBook     = "image is not one of the book's images"
+	ErrorImagesNotReordered = "images must list each of the book's images exactly once"
+	ErrorImagesChanged      = "the book's images were changed meanwhile, reload and try again"
+)
+
+// POST book/{bookId}/images
+func AddBookImagesHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+	return bookImagesHandler(req, AddBookImages)
+}
+
+// PUT book/{bookId}/images
+func ReorderBookImagesHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+	return bookImagesHandler(req, ReorderBookImages)
+}
+
+// PUT book/{bookId}/cover
+func SetBookCoverHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+	return bookImagesHandler(req, SetBookCover)
+}
+
+// DELETE book/{bookId}/images?url=
+func DeleteBookImageHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+	req.Body = ""
+	return bookImagesHandler(req, func(book models.Book, _ dtos.BookImages) (models.Book, error) {
+		return DeleteBookImage(book, req.QueryStringParameters["url"])
+	})
+}
+
+func bookImagesHandler(req events.APIGatewayProxyRequest,
+	change func(book models.Book, body dtos.BookImages) (models.Book, error)) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	var body dtos.BookImages
+	if req.Body != "" {
+		if err := json.Unmarshal([]byte(req.Body), &body); err != nil {
+			return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+				aws.String(err.Error()),
+			})
+		}
+	}
+	var book models.Book
+	if err := GetBook(req.PathParameters["bookId"], &book); err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	if book.Profile != helpers.CallerProfileId(req) {
+		return helpers.ApiResponse(http.StatusForbidden, ErrorBody{
+			aws.String(ErrorNotBookOwner),
+		})
+	}
+	updated, err := change(book, body)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, updated)
+}
+
+// CheckBookImages makes sure every image was uploaded here by the seller,
+// so a listing can't show files from anywhere on the internet or from
+// someone else's listing, and that the cover is one of the images. An empty
+// cover becomes the first image.
+func CheckBookImages(seller string, images []string, cover string) (string, error) {
+	known, err := storage.FindImages(images)
+	if err != nil {
+		return cover, errors.New(ErrorFailedToFetchRecord)
+	}
+	for _, image := range images {
+		record, ok := known[image]
+		if !ok {
+			return cover, errors.New(ErrorUnknownImage)
+		}
+		if record.Profile != seller {
+			return cover, errors.New(ErrorImageNotOwned)
+		}
+	}
+	if cover == "" && len(images) > 0 {
+		cover = images[0]
+	}
+	if cover != "" && indexOf(images, cover) < 0 {
+		return cover, errors.New(ErrorImageNotOnBook)
+	}
+	return cover, nil
+}
+
+// AddBookImages appends uploaded images to a book.
+func AddBookImages(book models.Book, body dtos.BookImages) (models.Book, error) {
+	images := append([]string{}, book.Images...)
+	for _, image := range body.Images {
+		if indexOf(images, image) < 0 {
+			images = append(images, image)
+		}
+	}
+	// a cover that isn't among the images is replaced by the first one
+	cover := book.CoverImage
+	if indexOf(images, cover) < 0 {
+		cover = ""
+	}
+	cover, err := CheckBookImages(book.Profile, images, cover)
+	if err != nil {
+		return book, err
+	}
+	return saveBookImages(book, images, cover)
+}
+
+// ReorderBookImages puts a book's images in a new order. The new order has
+// to name the same images, nothing added or dropped.
+func ReorderBookImages(book models.Book, body dtos.BookImages) (models.Book, error) {
+	if len(body.Images) != len(book.Images) {
+		return book, errors.New(ErrorImagesNotReordered)
+	}
+	seen := map[string]bool{}
+	for _, image := range body.Images {
+		if seen[image] || indexOf(book.Images, image) < 0 {
+			return book, errors.New(ErrorImagesNotReordered)
+		}
+		seen[image] = true
+	}
+	return saveBookImages(book, body.Images, book.CoverImage)
+}
+
+// SetBookCover picks one of the book's images as its cover.
+func SetBookCover(book models.Book, body dtos.BookImages) (models.Book, error) {
+	if indexOf(book.Images, body.Image) < 0 {
+		return book, errors.New(ErrorImageNotOnBook)
+	}
+	return saveBookImages(book, book.Images, body.Image)
+}
+
+// DeleteBookImage takes an image off a book and deletes the stored file,
+// unless another book still shows it. The next image becomes the cover when
+// the cover is deleted.
+func DeleteBookImage(book models.Book, url string) (models.Book, error) {
+	index := indexOf(book.Images, url)
+	if index < 0 {
+		return book, errors.New(ErrorImageNotOnBook)
+	}
+	images := append(append([]string{}, book.Images[:index]...), book.Images[index+1:]...)
+	cover := book.CoverImage
+	if cover == url {
+		cover = ""
+		if len(images) > 0 {
+			cover = images[0]
+		}
+	}
+	updated, err := saveBookImages(book, images, cover)
+	if err != nil {
+		return book, err
+	}
+	others, err := db.DatabaseObj.Collection("book").CountDocuments(context.Background(), bson.M{
+		"_id": bson.M{"$ne": book.ID},
+		"$or": bson.A{bson.M{"images": url}, bson.M{"coverimage": url}},
+	})
+	if err != nil {
+		fmt.Println(err, "COULD NOT CHECK OTHER USES OF IMAGE", url)
+		return updated, nil
+	}
+	if others > 0 {
+		return updated, nil
+	}
+	if err := storage.DeleteImage(storage.DefaultStore(), url); err != nil {
+		fmt.Println(err, "COULD NOT DELETE IMAGE FILE", url)
+	}
+	return updated, nil
+}
+
+// saveBookImages writes the images, cover and their variants. The update only
+// applies if the images are still the ones we started from, so two edits at
+// once can't overwrite each other.
+func saveBookImages(book models.Book, images []string, cover string) (models.Book, error) {
+	if images == nil {
+		images = []string{}
+	}
+	filter := bson.M{"_id": book.ID, "images": book.Images}
+	if len(book.Images) == 0 {
+		filter["images"] = bson.M{"$in": bson.A{nil, bson.A{}}}
+	}
+	result, err := db.DatabaseObj.Collection("book").UpdateOne(context.Background(), filter, bson.M{"$set": bson.M{
+		"images":         images,
+		"image_variants": storage.VariantsFor(images),
+		"coverimage":     cover,
+		"cover_variants": storage.VariantsOf(cover),
+		"updated_at":     time.Now(),
+	}})
+	if err != nil {
+		return book, errors.New(ErrorCouldNotUpdateItem)
+	}
+	if result.MatchedCount == 0 {
+		return book, errors.New(ErrorImagesChanged)
+	}
+
+	book.Images = images
+	book.ImageVariants = storage.VariantsFor(images)
+	book.CoverImage = cover
+	book.CoverVariants = storage.VariantsOf(cover)
+	return book, nil
+}
+
+func indexOf(list []string, value string) int {
+	for i, item := range list {
+		if item == value {
+			return i
+		}
+	}
+	return -1
+}
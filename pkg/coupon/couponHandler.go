@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"the-book-store/coupon"
+	"the-book-store/db"
+	"the-book-store/dtos"
+	"the-book-store/helpers"
+	"the-book-store/models"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrorFailedToFetchRecord = "failed to fetch record"
+	ErrorInvalidData         = "invalid data"
+	ErrorCouldNotUpdateItem  = "could not update item"
+	ErrorCouponNotFound      = "coupon not found"
+	ErrorCouponExists        = "coupon code already exists"
+	ErrorNotAllowed          = "not allowed"
+)
+
+type ErrorBody struct {
+	ErrorMsg *string `json:"error,omitempty"`
+}
+
+// GET coupon/
+func GetAllCouponsHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+	if !helpers.IsAdmin(helpers.CallerProfileId(req)) {
+		return helpers.ApiResponse(http.StatusForbidden, ErrorBody{
+			aws.String(ErrorNotAllowed),
+		})
+	}
+	payload, err := GetAllCoupons()
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, payload)
+}
+
+// POST coupon/
+func CreateCouponHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+	if !helpers.IsAdmin(helpers.CallerProfileId(req)) {
+		return helpers.ApiResponse(http.StatusForbidden, ErrorBody{
+			aws.String(ErrorNotAllowed),
+		})
+	}
+
+	var c models.Coupon
+	if err := json.Unmarshal([]byte(req.Body), &c); err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	err := CreateCoupon(&c)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusCreated, c)
+}
+
+// POST coupon/validate
+func ValidateCouponHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	var validation dtos.CouponValidation
+	if err := json.Unmarshal([]byte(req.Body), &validation); err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	// uses are counted for the caller, the same as at checkout
+	validation.Profile = helpers.CallerProfileId(req)
+	payload, err := ValidateCoupon(validation)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, payload)
+}
+
+func GetAllCoupons() ([]primitive.M, error) {
+	cur, err := db.DatabaseObj.Collection("coupon").Find(context.Background(), bson.D{{}})
+	if err != nil {
+		return nil, errors.New(ErrorFailedToFetchRecord)
+	}
+
+	var results []primitive.M
+	for cur.Next(context.Background()) {
+		var result bson.M
+		e := cur.Decode(&result)
+		if e != nil {
+			log.Fatal(e)
+		}
+		results = append(results, result)
+	}
+
+	if err := cur.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	cur.Close(context.Background())
+	return results, nil
+}
+
+// Insert one coupon in the DB
+func CreateCoupon(c *models.Coupon) error {
+	c.Code = coupon.NormalizeCode(c.Code)
+	if err := coupon.Check(*c); err != nil {
+		return err
+	}
+
+	var existing models.Coupon
+	if GetCouponByCode(c.Code, &existing) == nil {
+		return errors.New(ErrorCouponExists)
+	}
+
+	c.UsedCount = 0
+	c.CreatedAt = time.Now()
+	c.UpdatedAt = time.Now()
+	insertResult, err := db.DatabaseObj.Collection("coupon").InsertOne(context.Background(), c)
+	if err != nil {
+		return errors.New(ErrorCouldNotUpdateItem)
+	}
+
+	c.ID = insertResult.InsertedID.(primitive.ObjectID)
+	fmt.Println("Inserted a Single Record ", insertResult.InsertedID)
+	return nil
+}
+
+// ValidateCoupon prices the given books and tells the buyer how much the
+// coupon would take off, without reserving it.
+func ValidateCoupon(validation dtos.CouponValidation) (dtos.CouponResult, error) {
+	var c models.Coupon
+	if err := GetCouponByCode(validation.Code, &c); err != nil {
+		return dtos.CouponResult{}, err
+	}
+
+	var lines []coupon.Line
+	var subTotal float64
+	for _, item := range validation.Items {
+		var book models.Book
+		if err := GetBook(item.Book, &book); err != nil {
+			return dtos.CouponResult{}, err
+		}
+		amount := book.SellingPrice * float64(item.Quantity)
+		subTotal += amount
+		lines = append(lines, coupon.Line{
+			Book:     item.Book,
+			Seller:   book.Profile,
+			Category: book.Category,
+			Amount:   amount,
+		})
+	}
+
+	used, err := CountRedemptions(c.ID.Hex(), validation.Profile)
+	if err != nil {
+		return dtos.CouponResult{}, err
+	}
+	_, discount, err := coupon.Apply(c, lines, used, time.Now())
+	if err != nil {
+		return dtos.CouponResult{}, err
+	}
+	return dtos.CouponResult{
+		Code:     c.Code,
+		SubTotal: subTotal,
+		Discount: discount,
+		Total:    subTotal - discount,
+	}, nil
+}
+
+func GetCouponByCode(code string, c *models.Coupon) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := db.DatabaseObj.Collection("coupon").FindOne(ctx, bson.M{"code": coupon.NormalizeCode(code)}).Decode(c)
+	if err != nil {
+		return errors.New(ErrorCouponNotFound)
+	}
+	return nil
+}
+
+func CountRedemptions(couponId string, profileId string) (int64, error) {
+	if profileId == "" {
+		return 0, nil
+	}
+	count, err := db.DatabaseObj.Collection("coupon_redemption").CountDocuments(context.Background(), bson.M{
+		"coupon":  couponId,
+		"profile": profileId,
+	})
+	if err != nil {
+		return 0, errors.New(ErrorFailedToFetchRecord)
+	}
+	return count, nil
+}
+
+func GetBook(bookId string, book *models.Book) error {
+	id, _ := primitive.ObjectIDFromHex(bookId)
+	fmt.Println("Object id", id, bookId)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := db.DatabaseObj.Collection("book").FindOne(ctx, bson.M{"_id": id}).Decode(book)
+	if err != nil {
+		return errors.New(ErrorFailedToFetchRecord)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"the-book-store/helpers"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func MatchRouteCoupon(req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	fmt.Println("hello I`m inside the COUPON handler")
+	fmt.Printf("%+v\n", req)
+	switch req.HTTPMethod {
+	case "GET":
+		if req.Resource == "/coupon" {
+			return GetAllCouponsHandler(req)
+		} else {
+			return helpers.UnhandledMethod()
+		}
+	case "POST":
+		if req.Resource == "/coupon" {
+			return CreateCouponHandler(req)
+		} else if req.Resource == "/coupon/validate" {
+			return ValidateCouponHandler(req)
+		} else {
+			return helpers.UnhandledMethod()
+		}
+	default:
+		fmt.Println("Exiting handler")
+		return helpers.UnhandledMethod()
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"the-book-store/db"
+	"the-book-store/helpers"
+	"the-book-store/models"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultNotificationLimit = 50
+
+var (
+	ErrorFailedToFetchRecord  = "failed to fetch record"
+	ErrorCouldNotUpdateItem   = "could not update item"
+	ErrorMissingProfile       = "missing X-Profile-Id header"
+	ErrorNotificationNotFound = "notification not found"
+)
+
+type ErrorBody struct {
+	ErrorMsg *string `json:"error,omitempty"`
+}
+
+// GET notification/?unread=true&limit=50
+func GetNotificationsHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := helpers.CallerProfileId(req)
+	if profileId == "" {
+		return helpers.ApiResponse(http.StatusUnauthorized, ErrorBody{
+			aws.String(ErrorMissingProfile),
+		})
+	}
+	unreadOnly, _ := strconv.ParseBool(req.QueryStringParameters["unread"])
+	limit, err := strconv.ParseInt(req.QueryStringParameters["limit"], 10, 64)
+	if err != nil || limit <= 0 {
+		limit = defaultNotificationLimit
+	}
+	payload, err := GetNotifications(profileId, unreadOnly, limit)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, payload)
+}
+
+// PUT notification/{notificationId}/read
+func MarkNotificationReadHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := helpers.CallerProfileId(req)
+	if profileId == "" {
+		return helpers.ApiResponse(http.StatusUnauthorized, ErrorBody{
+			aws.String(ErrorMissingProfile),
+		})
+	}
+	notificationId := req.PathParameters["notificationId"]
+	err := MarkNotificationRead(profileId, notificationId)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, notificationId)
+}
+
+// PUT notification/readAll
+func MarkAllNotificationsReadHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := helpers.CallerProfileId(req)
+	if profileId == "" {
+		return helpers.ApiResponse(http.StatusUnauthorized, ErrorBody{
+			aws.String(ErrorMissingProfile),
+		})
+	}
+	count, err := MarkAllNotificationsRead(profileId)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, count)
+}
+
+// GetNotifications returns the newest notifications of a profile first.
+func GetNotifications(profileId string, unreadOnly bool, limit int64) ([]models.Notification, error) {
+	filter := bson.M{"profile": profileId}
+	if unreadOnly {
+		filter["read"] = false
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	cur, err := db.DatabaseObj.Collection("notification").Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, errors.New(ErrorFailedToFetchRecord)
+	}
+
+	results := []models.Notification{}
+	if err := cur.All(context.Background(), &results); err != nil {
+		return nil, errors.New(ErrorFailedToFetchRecord)
+	}
+	return results, nil
+}
+
+func MarkNotificationRead(profileId string, notificationId string) error {
+	id, _ := primitive.ObjectIDFromHex(notificationId)
+	// matching on the profile too stops anyone from touching another inbox
+	filter := bson.M{"_id": id, "profile": profileId}
+	update := bson.M{"$set": bson.M{"read": true, "read_at": time.Now(), "updated_at": time.Now()}}
+	result, err := db.DatabaseObj.Collection("notification").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return errors.New(ErrorCouldNotUpdateItem)
+	}
+	if result.MatchedCount == 0 {
+		return errors.New(ErrorNotificationNotFound)
+	}
+	return nil
+}
+
+func MarkAllNotificationsRead(profileId string) (int64, error) {
+	filter := bson.M{"profile": profileId, "read": false}
+	update := bson.M{"$set": bson.M{"read": true, "read_at": time.Now(), "updated_at": time.Now()}}
+	result, err := db.DatabaseObj.Collection("notification").UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		return 0, errors.New(ErrorCouldNotUpdateItem)
+	}
+	return result.ModifiedCount, nil
+}
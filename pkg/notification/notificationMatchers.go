@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"the-book-store/helpers"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func MatchRouteNotification(req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	fmt.Println("hello I`m inside the NOTIFICATION handler")
+	fmt.Printf("%+v\n", req)
+	switch req.HTTPMethod {
+	case "GET":
+		if req.Resource == "/notification" {
+			return GetNotificationsHandler(req)
+		} else {
+			return helpers.UnhandledMethod()
+		}
+	case "PUT":
+		if req.Resource == "/notification/readAll" {
+			return MarkAllNotificationsReadHandler(req)
+		} else if req.Resource == "/notification/{notificationId}/read" {
+			return MarkNotificationReadHandler(req)
+		} else {
+			return helpers.UnhandledMethod()
+		}
+	default:
+		fmt.Println("Exiting handler")
+		return helpers.UnhandledMethod()
+	}
+}
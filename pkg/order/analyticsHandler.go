@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"the-book-store/db"
+	"the-book-store/dtos"
+	"the-book-store/helpers"
+	"the-book-store/invoice"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	defaultAnalyticsDays = 30
+	maxAnalyticsDays     = 366
+	defaultTopBooks      = 5
+)
+
+// sales are bucketed by Indian calendar days
+const analyticsTimezone = "Asia/Kolkata"
+
+var (
+	ErrorNotAllowed     = "not allowed"
+	ErrorInvalidRange   = "from and to must be dates like 2026-10-01, from not after to, at most 366 days apart"
+	ErrorInvalidTopBook = "top must be a positive number"
+)
+
+// GET seller/{profileId}/analytics?from=2026-10-01&to=2026-10-31&top=5
+func GetSellerAnalyticsHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := req.PathParameters["profileId"]
+	caller := helpers.CallerProfileId(req)
+	if caller != profileId && !helpers.IsAdmin(caller) {
+		return helpers.ApiResponse(http.StatusForbidden, ErrorBody{
+			aws.String(ErrorNotAllowed),
+		})
+	}
+	from, to, err := analyticsRange(req.QueryStringParameters["from"], req.QueryStringParameters["to"])
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	top := int64(defaultTopBooks)
+	if raw := req.QueryStringParameters["top"]; raw != "" {
+		if top, err = strconv.ParseInt(raw, 10, 64); err != nil || top <= 0 {
+			return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+				aws.String(ErrorInvalidTopBook),
+			})
+		}
+	}
+	payload, err := GetSellerAnalytics(profileId, from, to, top)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, payload)
+}
+
+// analyticsRange reads the inclusive from/to dates, the last 30 days up to
+// today when they are left out. Both come back as midnight in IST.
+func analyticsRange(fromParam string, toParam string) (time.Time, time.Time, error) {
+	location, err := time.LoadLocation(analyticsTimezone)
+	if err != nil {
+		location = time.FixedZone("IST", 5*60*60+30*60)
+	}
+	now := time.Now().In(location)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	if toParam != "" {
+		if to, err = time.ParseInLocation("2006-01-02", toParam, location); err != nil {
+			return to, to, errors.New(ErrorInvalidRange)
+		}
+	}
+	from := to.AddDate(0, 0, 1-defaultAnalyticsDays)
+	if fromParam != "" {
+		if from, err = time.ParseInLocation("2006-01-02", fromParam, location); err != nil {
+			return from, to, errors.New(ErrorInvalidRange)
+		}
+	}
+	if from.After(to) || to.Sub(from) >= maxAnalyticsDays*24*time.Hour {
+		return from, to, errors.New(ErrorInvalidRange)
+	}
+	return from, to, nil
+}
+
+// GetSellerAnalytics works out a seller's sales in one aggregation over
+// their orders, each facet answering one part of the report.
+func GetSellerAnalytics(sellerId string, from time.Time, to time.Time, top int64) (dtos.SellerAnalytics, error) {
+	analytics := dtos.SellerAnalytics{
+		Seller:         sellerId,
+		From:           from.Format("2006-01-02"),
+		To:             to.Format("2006-01-02"),
+		OrdersByStatus: map[string]int64{},
+	}
+	sold := bson.M{"$match": bson.M{"status": bson.M{"$ne": OrderStatusCancelled}}}
+	sums := bson.M{
+		"revenue": bson.M{"$sum": "$amount"},
+		"units":   bson.M{"$sum": "$quantity"},
+		"orders":  bson.M{"$sum": 1},
+	}
+	withId := func(id interface{}) bson.M {
+		group := bson.M{"_id": id}
+		for field, sum := range sums {
+			group[field] = sum
+		}
+		return group
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cur, err := db.DatabaseObj.Collection("order").Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{
+			"seller":     sellerId,
+			"created_at": bson.M{"$gte": from, "$lt": to.AddDate(0, 0, 1)},
+		}},
+		bson.M{"$facet": bson.M{
+			"by_status": bson.A{
+				bson.M{"$group": bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}},
+			},
+			"totals": bson.A{
+				sold,
+				bson.M{"$group": bson.M{
+					"_id":      nil,
+					"revenue":  bson.M{"$sum": "$amount"},
+					"units":    bson.M{"$sum": "$quantity"},
+					"orders":   bson.M{"$sum": 1},
+					"shipping": bson.M{"$sum": "$shipping_charge"},
+					"tax":      bson.M{"$sum": "$tax.total"},
+					"discount": bson.M{"$sum": "$discount"},
+				}},
+			},
+			"top_books": bson.A{
+				sold,
+				bson.M{"$group": withId("$book")},
+				bson.M{"$sort": bson.D{{Key: "units", Value: -1}, {Key: "revenue", Value: -1}}},
+				bson.M{"$limit": top},
+			},
+			"daily": bson.A{
+				sold,
+				bson.M{"$group": withId(bson.M{"$dateToString": bson.M{
+					"format": "%Y-%m-%d", "date": "$created_at", "timezone": analyticsTimezone,
+				}})},
+			},
+			"weekly": bson.A{
+				sold,
+				bson.M{"$group": withId(bson.M{"$dateToString": bson.M{
+					"format": "%G-W%V", "date": "$created_at", "timezone": analyticsTimezone,
+				}})},
+			},
+		}},
+	})
+	if err != nil {
+		fmt.Println(err, "SELLER ANALYTICS FAILED")
+		return analytics, errors.New(ErrorFailedToFetchRecord)
+	}
+	defer cur.Close(ctx)
+
+	var facets []struct {
+		ByStatus []struct {
+			Status string `bson:"_id"`
+			Count  int64  `bson:"count"`
+		} `bson:"by_status"`
+		Totals []struct {
+			Revenue  float64 `bson:"revenue"`
+			Units    int64   `bson:"units"`
+			Orders   int64   `bson:"orders"`
+			Shipping float64 `bson:"shipping"`
+			Tax      float64 `bson:"tax"`
+			Discount float64 `bson:"discount"`
+		} `bson:"totals"`
+		TopBooks []dtos.BookSales  `bson:"top_books"`
+		Daily    []dtos.SalesPoint `bson:"daily"`
+		Weekly   []dtos.SalesPoint `bson:"weekly"`
+	}
+	if err := cur.All(ctx, &facets); err != nil || len(facets) != 1 {
+		fmt.Println(err, "SELLER ANALYTICS DECODE FAILED")
+		return analytics, errors.New(ErrorFailedToFetchRecord)
+	}
+	result := facets[0]
+
+	for _, status := range result.ByStatus {
+		analytics.OrdersByStatus[status.Status] = status.Count
+	}
+	if len(result.Totals) == 1 {
+		totals := result.Totals[0]
+		analytics.Revenue = invoice.Round(totals.Revenue)
+		analytics.UnitsSold = totals.Units
+		analytics.Orders = totals.Orders
+		analytics.Shipping = invoice.Round(totals.Shipping)
+		analytics.Tax = invoice.Round(totals.Tax)
+		analytics.Discount = invoice.Round(totals.Discount)
+		if totals.Orders > 0 {
+			analytics.AverageOrderValue = invoice.Round(totals.Revenue / float64(totals.Orders))
+		}
+	}
+
+	analytics.TopBooks = result.TopBooks
+	if analytics.TopBooks == nil {
+		analytics.TopBooks = []dtos.BookSales{}
+	}
+	var bookIds []string
+	for _, book := range analytics.TopBooks {
+		bookIds = append(bookIds, book.Book)
+	}
+	books, err := GetBookSummaries(bookIds)
+	if err != nil {
+		return analytics, err
+	}
+	for index := range analytics.TopBooks {
+		sales := &analytics.TopBooks[index]
+		sales.Revenue = invoice.Round(sales.Revenue)
+		if title, ok := books[sales.Book]["title"].(string); ok {
+			sales.Title = title
+		}
+	}
+
+	analytics.Daily, analytics.Weekly = salesSeries(from, to, result.Daily, result.Weekly)
+	return analytics, nil
+}
+
+// salesSeries lists every day and ISO week of the range in order, with zeros
+// where nothing was sold, so charts don't have to fill the gaps.
+func salesSeries(from time.Time, to time.Time, daily []dtos.SalesPoint, weekly []dtos.SalesPoint) ([]dtos.SalesPoint, []dtos.SalesPoint) {
+	byPeriod := map[string]dtos.SalesPoint{}
+	for _, point := range append(daily, weekly...) {
+		point.Revenue = invoice.Round(point.Revenue)
+		byPeriod[point.Period] = point
+	}
+
+	days, weeks := []dtos.SalesPoint{}, []dtos.SalesPoint{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		days = append(days, salesPoint(byPeriod, day.Format("2006-01-02")))
+		year, week := day.ISOWeek()
+		period := fmt.Sprintf("%d-W%02d", year, week)
+		if len(weeks) == 0 || weeks[len(weeks)-1].Period != period {
+			weeks = append(weeks, salesPoint(byPeriod, period))
+		}
+	}
+	return days, weeks
+}
+
+func salesPoint(byPeriod map[string]dtos.SalesPoint, period string) dtos.SalesPoint {
+	if point, ok := byPeriod[period]; ok {
+		return point
+	}
+	return dtos.SalesPoint{Period: period}
+}
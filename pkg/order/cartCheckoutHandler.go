@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"the-book-store/db"
+	"the-book-store/dtos"
+	"the-book-store/helpers"
+	"the-book-store/models"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrorMissingProfile = "missing X-Profile-Id header"
+	ErrorEmptyCart      = "cart is empty"
+)
+
+// POST cart/checkout
+func CartCheckoutHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := helpers.CallerProfileId(req)
+	if profileId == "" {
+		return helpers.ApiResponse(http.StatusUnauthorized, ErrorBody{
+			aws.String(ErrorMissingProfile),
+		})
+	}
+	// only the stripe token, coupon code and description are taken from the
+	// client, the orders are built from the stored cart
+	var payment dtos.Payment
+	if err := json.Unmarshal([]byte(req.Body), &payment); err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	err := CheckoutCart(profileId, &payment)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusCreated, payment.Orders)
+}
+
+// CheckoutCart turns the cart of a profile into orders, one per book, charges
+// the buyer and empties the cart.
+func CheckoutCart(profileId string, payment *dtos.Payment) error {
+	var profile models.Profile
+	if err := GetProfile(profileId, &profile); err != nil {
+		return err
+	}
+	if len(profile.Cart) == 0 {
+		return errors.New(ErrorEmptyCart)
+	}
+
+	payment.Orders = nil
+	for _, item := range profile.Cart {
+		payment.Orders = append(payment.Orders, models.Order{
+			Buyer:      profileId,
+			Book:       item.Book,
+			Quantity:   item.Quantity,
+			Status:     OrderStatusInProgress,
+			BuyerName:  profile.Username,
+			BuyerEmail: profile.Email,
+			Phone:      profile.Phone,
+			Address1:   profile.Address1,
+			Address2:   profile.Address2,
+			Pincode:    profile.Pincode,
+			State:      profile.State,
+		})
+	}
+	if payment.ReceiptEmail == "" {
+		payment.ReceiptEmail = profile.Email
+	}
+	payment.IdempotencyKey = cartCheckoutKey(profileId, profile.Cart)
+
+	// the seller of every order is filled in while pricing, and orders of the
+	// same seller then share a parcel and an invoice
+	if err := Checkout(profileId, payment); err != nil {
+		return err
+	}
+	// the buyer has paid by now, failing here would have them retry and pay
+	// twice for the same cart
+	if err := EmptyCart(profileId); err != nil {
+		fmt.Println(err, "PAID BUT COULD NOT EMPTY CART", profileId)
+	}
+	return nil
+}
+
+// cartCheckoutKey is the same for every attempt to check out the same cart,
+// and changes as soon as an item is added or changed.
+func cartCheckoutKey(profileId string, cart []models.CartItem) string {
+	hash := sha256.New()
+	hash.Write([]byte(profileId))
+	for _, item := range cart {
+		fmt.Fprintf(hash, "|%s:%d:%d", item.Book, item.Quantity, item.UpdatedAt.UnixNano())
+	}
+	return "cart-" + hex.EncodeToString(hash.Sum(nil))
+}
+
+func EmptyCart(profileId string) error {
+	id, _ := primitive.ObjectIDFromHex(profileId)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err := db.DatabaseObj.Collection("profile").UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"cart":       []models.CartItem{},
+		"updated_at": time.Now(),
+	}})
+	if err != nil {
+		return errors.New(ErrorCouldNotUpdateItem)
+	}
+	return nil
+}
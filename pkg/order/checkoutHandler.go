@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"the-book-store/coupon"
+	"the-book-store/dtos"
+	"the-book-store/invoice"
+	"the-book-store/models"
+	"the-book-store/shipping"
+	"the-book-store/tax"
+)
+
+// only books with this status can be bought
+const BookStatusActive = "ACTIVE"
+
+var (
+	ErrorEmptyCheckout      = "no orders to checkout"
+	ErrorBookNotSold        = "book is no longer sold"
+	ErrorInvalidQuantity    = "invalid quantity"
+	ErrorInsufficientStock  = "not enough stock left"
+	ErrorMixedDeliveryAddrs = "all orders of a checkout must ship to the same pincode"
+)
+
+// Checkout prices the orders of a payment, charges the customer and stores
+// the orders along with their invoices. profileId is the caller, whose
+// coupon uses are counted.
+func Checkout(profileId string, payment *dtos.Payment) error {
+	if err := PriceCheckout(profileId, payment); err != nil {
+		return err
+	}
+	if err := ReserveStock(payment.Orders); err != nil {
+		return err
+	}
+	if payment.CouponCode != "" {
+		if err := ReserveCoupon(payment.CouponCode, profileId); err != nil {
+			ReleaseStock(payment.Orders)
+			return err
+		}
+	}
+	if err := Payment(payment); err != nil {
+		fmt.Println(err, "PAYMENT ERROR")
+		if payment.CouponCode != "" {
+			ReleaseCoupon(payment.CouponCode, profileId)
+		}
+		ReleaseStock(payment.Orders)
+		return err
+	}
+	if err := CreateOrder(payment.Orders); err != nil {
+		// the charge stands, but with an idempotency key a retry of the same
+		// checkout gets the same charge back and only creates the orders
+		fmt.Println(err, "PAID BUT COULD NOT CREATE ORDERS, KEY:", payment.IdempotencyKey)
+		if payment.CouponCode != "" {
+			ReleaseCoupon(payment.CouponCode, profileId)
+		}
+		ReleaseStock(payment.Orders)
+		return err
+	}
+	if payment.CouponCode != "" {
+		if err := RecordRedemption(payment.CouponCode, profileId, payment.Orders, payment.Discount); err != nil {
+			fmt.Println(err, "COUPON REDEMPTION ERROR")
+		}
+	}
+	// the customer has been charged by now, a missing invoice must not fail
+	// the order. Orders left without one aren't marked invoiced and get it
+	// the first time it is asked for.
+	if err := CreateInvoices(payment.Orders); err != nil {
+		fmt.Println(err, "INVOICE ERROR, RAISED ON DEMAND LATER")
+	}
+	return nil
+}
+
+// PriceCheckout recomputes every amount of a checkout from the current book
+// prices and shipping rates, so the total charged never comes from the client.
+// Selling prices include GST; the tax contained in each order is broken out
+// on the order.
+func PriceCheckout(profileId string, payment *dtos.Payment) error {
+	if len(payment.Orders) == 0 {
+		return errors.New(ErrorEmptyCheckout)
+	}
+	pincode := payment.Orders[0].Pincode
+
+	var items []shipping.Item
+	var lines []coupon.Line
+	books := make([]models.Book, len(payment.Orders))
+	sellers := map[string]models.Profile{}
+	payment.SubTotal = 0
+	payment.TaxAmount = 0
+	payment.Discount = 0
+	for index := range payment.Orders {
+		order := &payment.Orders[index]
+		if order.Pincode != pincode {
+			return errors.New(ErrorMixedDeliveryAddrs)
+		}
+		if order.Quantity < 1 {
+			return errors.New(ErrorInvalidQuantity)
+		}
+
+		book := &books[index]
+		if err := GetBook(order.Book, book); err != nil {
+			return err
+		}
+		if book.Status != BookStatusActive {
+			return fmt.Errorf("%s: %s", ErrorBookNotSold, book.Title)
+		}
+		if order.Quantity > book.StocksLeft {
+			return fmt.Errorf("%s: %s", ErrorInsufficientStock, book.Title)
+		}
+
+		seller, ok := sellers[book.Profile]
+		if !ok {
+			GetProfile(book.Profile, &seller)
+			sellers[book.Profile] = seller
+		}
+
+		order.Seller = book.Profile
+		order.Amount = invoice.Round(book.SellingPrice * float64(order.Quantity))
+		order.Discount = 0
+		payment.SubTotal += order.Amount
+
+		lines = append(lines, coupon.Line{
+			Book:     order.Book,
+			Seller:   book.Profile,
+			Category: book.Category,
+			Amount:   order.Amount,
+		})
+		items = append(items, shipping.Item{
+			Book:        order.Book,
+			Seller:      book.Profile,
+			FromPincode: seller.Pincode,
+			Weight:      shipping.ItemWeight(book.Weight, order.Quantity),
+		})
+	}
+
+	if payment.CouponCode != "" {
+		discounts, err := ApplyCoupon(payment.CouponCode, profileId, lines)
+		if err != nil {
+			return err
+		}
+		for index := range payment.Orders {
+			payment.Orders[index].Discount = discounts[index]
+			payment.Orders[index].Amount = invoice.Round(payment.Orders[index].Amount - discounts[index])
+			payment.Discount += discounts[index]
+		}
+	}
+
+	// GST is charged on the price after discount
+	for index := range payment.Orders {
+		order := &payment.Orders[index]
+		seller := sellers[order.Seller]
+		order.Tax = tax.Compute(order.Amount, tax.ClassOf(books[index]), seller.State, order.State)
+		payment.TaxAmount += order.Tax.Total
+	}
+
+	shipments, shippingTotal, err := shipping.QuoteShipments(items, pincode)
+	if err != nil {
+		return err
+	}
+	splitShippingCharges(payment.Orders, items, shipments)
+
+	payment.SubTotal = invoice.Round(payment.SubTotal)
+	payment.TaxAmount = invoice.Round(payment.TaxAmount)
+	payment.Discount = invoice.Round(payment.Discount)
+	payment.ShippingAmount = invoice.Round(shippingTotal)
+	payment.TotalAmount = toPaise(payment.SubTotal - payment.Discount + payment.ShippingAmount)
+	fmt.Println(payment.SubTotal, payment.ShippingAmount, payment.TotalAmount, "CHECKOUT TOTALS")
+	return nil
+}
+
+// splitShippingCharges spreads the charge of each seller's parcel over that
+// seller's orders by weight; the last order takes the rounding remainder.
+func splitShippingCharges(orders []models.Order, items []shipping.Item, shipments []shipping.Shipment) {
+	for _, shipment := range shipments {
+		var last int
+		var assigned float64
+		for index := range orders {
+			if items[index].Seller != shipment.Seller {
+				continue
+			}
+			share := 0.0
+			if shipment.Weight > 0 {
+				share = invoice.Round(shipment.Charge * items[index].Weight / shipment.Weight)
+			}
+			orders[index].ShippingCharge = share
+			assigned += share
+			last = index
+		}
+		orders[last].ShippingCharge = invoice.Round(orders[last].ShippingCharge + shipment.Charge - assigned)
+	}
+}
+
+// Stripe expects INR amounts in paise.
+func toPaise(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// EstimateDeliveryDate computes when an order should reach the buyer from
+// the day it was placed, the seller's handling time, the book's delivery time
+// and the shipping zone.
+func EstimateDeliveryDate(order models.Order) time.Time {
+	var book models.Book
+	GetBook(order.Book, &book)
+	var seller models.Profile
+	GetProfile(book.Profile, &seller)
+
+	zone := shipping.Zone(seller.Pincode, order.Pincode)
+	return shipping.EstimateDelivery(order.CreatedAt, seller.HandlingDays, book.DeliveryTime, zone)
+}
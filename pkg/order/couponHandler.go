@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"the-book-store/coupon"
+	"the-book-store/db"
+	"the-book-store/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var ErrorCouponNotFound = "coupon not found"
+
+// ApplyCoupon returns the discount a coupon gives on each checkout line.
+func ApplyCoupon(code string, buyer string, lines []coupon.Line) ([]float64, error) {
+	var c models.Coupon
+	if err := GetCouponByCode(code, &c); err != nil {
+		return nil, err
+	}
+	used, err := CountRedemptions(c.ID.Hex(), buyer)
+	if err != nil {
+		return nil, err
+	}
+	discounts, _, err := coupon.Apply(c, lines, used, time.Now())
+	return discounts, err
+}
+
+// ReserveCoupon takes one use of the coupon, and one of the caller's own
+// uses, before the customer is charged. The limits are part of the filters
+// so concurrent checkouts cannot redeem the coupon more often than allowed.
+func ReserveCoupon(code string, profileId string) error {
+	var c models.Coupon
+	if err := GetCouponByCode(code, &c); err != nil {
+		return err
+	}
+	if err := reserveUserCoupon(c, profileId); err != nil {
+		return err
+	}
+	result, err := db.DatabaseObj.Collection("coupon").UpdateOne(context.Background(),
+		bson.M{
+			"code": coupon.NormalizeCode(code),
+			"$or": bson.A{
+				bson.M{"usage_limit": 0},
+				bson.M{"$expr": bson.M{"$lt": bson.A{"$used_count", "$usage_limit"}}},
+			},
+		},
+		bson.M{"$inc": bson.M{"used_count": 1}},
+	)
+	if err != nil || result.ModifiedCount == 0 {
+		releaseUserCoupon(c, profileId)
+	}
+	if err != nil {
+		return errors.New(ErrorCouldNotUpdateItem)
+	}
+	if result.ModifiedCount == 0 {
+		return errors.New(coupon.ErrorCouponUsedUp)
+	}
+	return nil
+}
+
+// ReleaseCoupon gives back a use taken by ReserveCoupon when the payment fails.
+func ReleaseCoupon(code string, profileId string) {
+	var c models.Coupon
+	if err := GetCouponByCode(code, &c); err != nil {
+		fmt.Println(err, "COULD NOT RELEASE COUPON")
+		return
+	}
+	_, err := db.DatabaseObj.Collection("coupon").UpdateOne(context.Background(),
+		bson.M{"_id": c.ID},
+		bson.M{"$inc": bson.M{"used_count": -1}},
+	)
+	if err != nil {
+		fmt.Println(err, "COULD NOT RELEASE COUPON")
+	}
+	releaseUserCoupon(c, profileId)
+}
+
+// couponUsageId names the counter of one profile's uses of a coupon. Using
+// it as the _id makes the counter unique without a separate index.
+func couponUsageId(c models.Coupon, profileId string) string {
+	return c.ID.Hex() + ":" + profileId
+}
+
+// reserveUserCoupon takes one of the caller's uses of a coupon with a
+// per-user limit. The counter starts from the redemptions recorded before
+// counters existed.
+func reserveUserCoupon(c models.Coupon, profileId string) error {
+	if c.PerUserLimit == 0 {
+		return nil
+	}
+	usage := db.DatabaseObj.Collection("coupon_usage")
+	id := couponUsageId(c, profileId)
+	count, err := usage.CountDocuments(context.Background(), bson.M{"_id": id})
+	if err != nil {
+		return errors.New(ErrorFailedToFetchRecord)
+	}
+	if count == 0 {
+		used, err := CountRedemptions(c.ID.Hex(), profileId)
+		if err != nil {
+			return err
+		}
+		// a concurrent checkout may have created it already, its _id wins
+		usage.InsertOne(context.Background(), bson.M{
+			"_id":     id,
+			"coupon":  c.ID.Hex(),
+			"profile": profileId,
+			"count":   used,
+		})
+	}
+	result, err := usage.UpdateOne(context.Background(),
+		bson.M{"_id": id, "count": bson.M{"$lt": c.PerUserLimit}},
+		bson.M{"$inc": bson.M{"count": 1}},
+	)
+	if err != nil {
+		return errors.New(ErrorCouldNotUpdateItem)
+	}
+	if result.ModifiedCount == 0 {
+		return errors.New(coupon.ErrorCouponUserLimit)
+	}
+	return nil
+}
+
+func releaseUserCoupon(c models.Coupon, profileId string) {
+	if c.PerUserLimit == 0 {
+		return
+	}
+	_, err := db.DatabaseObj.Collection("coupon_usage").UpdateOne(context.Background(),
+		bson.M{"_id": couponUsageId(c, profileId), "count": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"count": -1}},
+	)
+	if err != nil {
+		fmt.Println(err, "COULD NOT RELEASE COUPON FOR PROFILE", profileId)
+	}
+}
+
+// RecordRedemption remembers who used a coupon on which orders.
+func RecordRedemption(code string, profileId string, orders []models.Order, discount float64) error {
+	var c models.Coupon
+	if err := GetCouponByCode(code, &c); err != nil {
+		return err
+	}
+	redemption := models.CouponRedemption{
+		Coupon:    c.ID.Hex(),
+		Code:      c.Code,
+		Profile:   profileId,
+		Discount:  discount,
+		CreatedAt: time.Now(),
+	}
+	for _, order := range orders {
+		redemption.Orders = append(redemption.Orders, order.ID.Hex())
+	}
+	_, err := db.DatabaseObj.Collection("coupon_redemption").InsertOne(context.Background(), redemption)
+	if err != nil {
+		return errors.New(ErrorCouldNotUpdateItem)
+	}
+	return nil
+}
+
+func GetCouponByCode(code string, c *models.Coupon) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := db.DatabaseObj.Collection("coupon").FindOne(ctx, bson.M{"code": coupon.NormalizeCode(code)}).Decode(c)
+	if err != nil {
+		return errors.New(ErrorCouponNotFound)
+	}
+	return nil
+}
+
+func CountRedemptions(couponId string, profileId string) (int64, error) {
+	if profileId == "" {
+		return 0, nil
+	}
+	count, err := db.DatabaseObj.Collection("coupon_redemption").CountDocuments(context.Background(), bson.M{
+		"coupon":  couponId,
+		"profile": profileId,
+	})
+	if err != nil {
+		return 0, errors.New(ErrorFailedToFetchRecord)
+	}
+	return count, nil
+}
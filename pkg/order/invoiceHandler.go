@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"the-book-store/db"
+	"the-book-store/helpers"
+	"the-book-store/invoice"
+	"the-book-store/models"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrorInvoiceNotFound = "invoice not found"
+
+// GET order/{orderId}/invoice?format=pdf|html
+func GetInvoiceHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	orderId := req.PathParameters["orderId"]
+	var order models.Order
+	if err := GetOrder(orderId, &order); err != nil {
+		return helpers.ApiResponse(http.StatusNotFound, ErrorBody{
+			aws.String(ErrorInvoiceNotFound),
+		})
+	}
+	// only the two parties of the order may read its invoice
+	caller := helpers.CallerProfileId(req)
+	if caller == "" || caller != order.Buyer && caller != order.Seller && !helpers.IsAdmin(caller) {
+		return helpers.ApiResponse(http.StatusForbidden, ErrorBody{
+			aws.String(ErrorNotAllowed),
+		})
+	}
+	var inv models.Invoice
+	err := GetInvoiceByOrder(orderId, &inv)
+	if err != nil {
+		// the invoice couldn't be raised at checkout, raise it now
+		err = CreateOrderInvoice(order, &inv)
+	}
+	if err != nil {
+		return helpers.ApiResponse(http.StatusNotFound, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+
+	fileName := fmt.Sprintf("invoice-%s-%06d", inv.FinancialYear, inv.Sequence)
+	if req.QueryStringParameters["format"] == "pdf" {
+		body, err := invoice.PDF(inv)
+		if err != nil {
+			return helpers.ApiResponse(http.StatusInternalServerError, ErrorBody{
+				aws.String(err.Error()),
+			})
+		}
+		return helpers.FileResponse(http.StatusOK, "application/pdf", fileName+".pdf", body, true)
+	}
+
+	body, err := invoice.HTML(inv)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusInternalServerError, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.FileResponse(http.StatusOK, "text/html; charset=utf-8", fileName+".html", body, false)
+}
+
+func GetInvoiceByOrder(orderId string, inv *models.Invoice) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := db.DatabaseObj.Collection("invoice").FindOne(ctx, bson.M{"orders": orderId}).Decode(inv)
+	if err != nil {
+		return errors.New(ErrorInvoiceNotFound)
+	}
+	return nil
+}
+
+// CreateInvoices raises one invoice per seller for the orders of a checkout,
+// since every seller bills the buyer separately. Orders an invoice was raised
+// for are marked invoiced; the others get one from CreateOrderInvoice when
+// it is first asked for.
+func CreateInvoices(orders []models.Order) error {
+	var sellers []string
+	bySeller := map[string][]models.Order{}
+	for _, order := range orders {
+		if _, ok := bySeller[order.Seller]; !ok {
+			sellers = append(sellers, order.Seller)
+		}
+		bySeller[order.Seller] = append(bySeller[order.Seller], order)
+	}
+
+	var failed error
+	for _, seller := range sellers {
+		if err := raiseInvoice(seller, bySeller[seller], nil); err != nil {
+			fmt.Println(err, "COULD NOT RAISE INVOICE FOR SELLER", seller)
+			failed = err
+		}
+	}
+	return failed
+}
+
+// CreateOrderInvoice raises the invoice of an order that has none. The order
+// is claimed first so two requests at once can't invoice it twice.
+func CreateOrderInvoice(order models.Order, inv *models.Invoice) error {
+	orders := db.DatabaseObj.Collection("order")
+	result, err := orders.UpdateOne(context.Background(),
+		bson.M{"_id": order.ID, "invoiced": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"invoiced": true}},
+	)
+	if err != nil || result.ModifiedCount == 0 {
+		return errors.New(ErrorInvoiceNotFound)
+	}
+	if err := raiseInvoice(order.Seller, []models.Order{order}, inv); err != nil {
+		fmt.Println(err, "COULD NOT RAISE INVOICE FOR ORDER", order.ID.Hex())
+		orders.UpdateOne(context.Background(), bson.M{"_id": order.ID}, bson.M{"$set": bson.M{"invoiced": false}})
+		return errors.New(ErrorInvoiceNotFound)
+	}
+	return nil
+}
+
+// raiseInvoice builds and stores the invoice of one seller's orders and
+// marks them invoiced, filling in inv when it is given.
+func raiseInvoice(seller string, orders []models.Order, inv *models.Invoice) error {
+	built, err := buildInvoice(seller, orders)
+	if err != nil {
+		return err
+	}
+	insertResult, err := db.DatabaseObj.Collection("invoice").InsertOne(context.Background(), built)
+	if err != nil {
+		return errors.New(ErrorCouldNotUpdateItem)
+	}
+	built.ID = insertResult.InsertedID.(primitive.ObjectID)
+
+	var ids []primitive.ObjectID
+	for _, order := range orders {
+		ids = append(ids, order.ID)
+	}
+	_, err = db.DatabaseObj.Collection("order").UpdateMany(context.Background(),
+		bson.M{"_id": bson.M{"$in": ids}},
+		bson.M{"$set": bson.M{"invoiced": true}},
+	)
+	if err != nil {
+		fmt.Println(err, "COULD NOT MARK ORDERS INVOICED", built.Number)
+	}
+	if inv != nil {
+		*inv = *built
+	}
+	return nil
+}
+
+// buildInvoice takes the invoice number last, once everything the invoice
+// needs has loaded, so a failed lookup can't leave a gap in the year's
+// numbering.
+func buildInvoice(sellerId string, orders []models.Order) (*models.Invoice, error) {
+	now := time.Now()
+	inv := &models.Invoice{CreatedAt: now}
+
+	var seller models.Profile
+	if err := GetProfile(sellerId, &seller); err != nil {
+		return nil, err
+	}
+	inv.Seller = models.InvoiceParty{
+		Profile:  sellerId,
+		Name:     seller.Username,
+		Email:    seller.Email,
+		Phone:    seller.Phone,
+		Address1: seller.Address1,
+		Address2: seller.Address2,
+		Pincode:  seller.Pincode,
+		State:    seller.State,
+		Gstin:    seller.Gstin,
+	}
+
+	buyer := orders[0]
+	inv.Buyer = models.InvoiceParty{
+		Profile:  buyer.Buyer,
+		Name:     buyer.BuyerName,
+		Email:    buyer.BuyerEmail,
+		Phone:    buyer.Phone,
+		Address1: buyer.Address1,
+		Address2: buyer.Address2,
+		Pincode:  buyer.Pincode,
+		State:    buyer.State,
+	}
+
+	var shippingCharge float64
+	for _, order := range orders {
+		var book models.Book
+		if err := GetBook(order.Book, &book); err != nil {
+			return nil, err
+		}
+		item := models.InvoiceLineItem{
+			Order:        order.ID.Hex(),
+			Book:         order.Book,
+			Title:        book.Title,
+			Quantity:     order.Quantity,
+			TaxableValue: order.Amount,
+			Amount:       order.Amount,
+		}
+		if order.Tax.Class != "" {
+			item.TaxableValue = order.Tax.TaxableValue
+			item.TaxAmount = order.Tax.Total
+			addTaxes(inv, order.Tax)
+		}
+		if order.Quantity > 0 {
+			item.UnitPrice = invoice.Round(order.Amount / float64(order.Quantity))
+		}
+		inv.Orders = append(inv.Orders, order.ID.Hex())
+		inv.LineItems = append(inv.LineItems, item)
+		shippingCharge += order.ShippingCharge
+	}
+	if shippingCharge > 0 {
+		inv.LineItems = append(inv.LineItems, models.InvoiceLineItem{
+			Title:        "Shipping charges",
+			Quantity:     1,
+			UnitPrice:    invoice.Round(shippingCharge),
+			TaxableValue: invoice.Round(shippingCharge),
+			Amount:       invoice.Round(shippingCharge),
+		})
+	}
+	invoice.Totals(inv)
+
+	financialYear := invoice.FinancialYear(now)
+	sequence, err := nextInvoiceSequence(financialYear)
+	if err != nil {
+		return nil, err
+	}
+	inv.Number = invoice.Number(financialYear, sequence)
+	inv.FinancialYear = financialYear
+	inv.Sequence = sequence
+	return inv, nil
+}
+
+// addTaxes adds the GST of an order to the invoice's tax summary, one row
+// per tax and rate.
+func addTaxes(inv *models.Invoice, breakdown models.TaxBreakdown) {
+	rows := []models.InvoiceTaxSummary{
+		{Name: "CGST", Rate: breakdown.Rate / 2, Amount: breakdown.CGST},
+		{Name: "SGST", Rate: breakdown.Rate / 2, Amount: breakdown.SGST},
+		{Name: "IGST", Rate: breakdown.Rate, Amount: breakdown.IGST},
+	}
+	for _, row := range rows {
+		if row.Amount == 0 {
+			continue
+		}
+		found := false
+		for i := range inv.Taxes {
+			if inv.Taxes[i].Name == row.Name && inv.Taxes[i].Rate == row.Rate {
+				inv.Taxes[i].Amount = invoice.Round(inv.Taxes[i].Amount + row.Amount)
+				found = true
+			}
+		}
+		if !found {
+			inv.Taxes = append(inv.Taxes, row)
+		}
+	}
+}
+
+// nextInvoiceSequence atomically hands out the next invoice sequence for a
+// financial year, creating the counter on the first invoice of the year.
+func nextInvoiceSequence(financialYear string) (int64, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := db.DatabaseObj.Collection("counter").FindOneAndUpdate(context.Background(),
+		bson.M{"_id": "invoice-" + financialYear},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		opts,
+	).Decode(&counter)
+	if err != nil {
+		return 0, errors.New(ErrorCouldNotUpdateItem)
+	}
+	return counter.Seq, nil
+}
+
+func GetProfile(profileId string, profile *models.Profile) error {
+	id, _ := primitive.ObjectIDFromHex(profileId)
+	fmt.Println("Object id", id, profileId)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := db.DatabaseObj.Collection("profile").FindOne(ctx, bson.M{"_id": id}).Decode(profile)
+	if err != nil {
+		return errors.New(ErrorFailedToFetchRecord)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+
+	"the-book-store/models"
+	"the-book-store/notifications"
+)
+
+// the buyer is emailed when an order reaches one of these statuses
+var statusEmails = map[string]string{
+	OrderStatusShipped:   notifications.OrderShipped,
+	OrderStatusDelivered: notifications.OrderDelivered,
+	OrderStatusCancelled: notifications.OrderCancelled,
+}
+
+// NotifyOrderPlaced confirms the order to the buyer and tells the seller
+// they made a sale.
+func NotifyOrderPlaced(order models.Order) {
+	var book models.Book
+	GetBook(order.Book, &book)
+	data := orderEmail(order, book)
+
+	data.Name = order.BuyerName
+	notifications.Email(notifications.OrderPlaced, order.BuyerEmail, data)
+	notifications.Store(order.Buyer, notifications.OrderPlaced, orderPayload(order, book))
+
+	var seller models.Profile
+	if GetProfile(order.Seller, &seller) == nil {
+		data.Name = seller.Username
+		notifications.Email(notifications.NewSale, seller.Email, data)
+	}
+	notifications.Store(order.Seller, notifications.NewSale, orderPayload(order, book))
+}
+
+// NotifyOrderStatus emails the buyer when their order ships, is delivered
+// or is cancelled.
+func NotifyOrderStatus(orderId string) {
+	var order models.Order
+	if GetOrder(orderId, &order) != nil {
+		return
+	}
+	kind, ok := statusEmails[strings.ToUpper(order.Status)]
+	if !ok {
+		return
+	}
+	var book models.Book
+	GetBook(order.Book, &book)
+	data := orderEmail(order, book)
+	data.Name = order.BuyerName
+	notifications.Email(kind, order.BuyerEmail, data)
+	notifications.Store(order.Buyer, kind, orderPayload(order, book))
+}
+
+func orderPayload(order models.Order, book models.Book) map[string]interface{} {
+	return map[string]interface{}{
+		"order":    order.ID.Hex(),
+		"book":     order.Book,
+		"title":    book.Title,
+		"quantity": order.Quantity,
+		"status":   order.Status,
+	}
+}
+
+func orderEmail(order models.Order, book models.Book) notifications.OrderEmail {
+	var address []string
+	for _, line := range []string{order.BuyerName, order.Address1, order.Address2, order.Pincode, order.Phone} {
+		if line != "" {
+			address = append(address, line)
+		}
+	}
+	return notifications.OrderEmail{
+		OrderId:      order.ID.Hex(),
+		BookTitle:    book.Title,
+		Quantity:     order.Quantity,
+		Amount:       order.Amount,
+		BuyerName:    order.BuyerName,
+		Address:      strings.Join(address, ", "),
+		DeliveryDate: order.DeliveryDate.Time,
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
@@ -33,6 +34,13 @@ var (
 	ErrorCouldNotUpdateItem      = "could not update item"
 )
 
+const (
+	OrderStatusInProgress = "IN PROGRESS"
+	OrderStatusShipped    = "SHIPPED"
+	OrderStatusDelivered  = "DELIVERED"
+	OrderStatusCancelled  = "CANCELLED"
+)
+
 type ErrorBody struct {
 	ErrorMsg *string `json:"error,omitempty"`
 }
@@ -99,7 +107,6 @@ func CreateOrderHandler(req events.APIGatewayProxyRequest) (
 	error,
 ) {
 
-	var orders []models.Order
 	var payment dtos.Payment
 	if err := json.Unmarshal([]byte(req.Body), &payment); err != nil {
 		fmt.Println(err, "PAYMENT ERROR 1")
@@ -108,21 +115,19 @@ func CreateOrderHandler(req events.APIGatewayProxyRequest) (
 		})
 	}
 	fmt.Println(payment, req.Body)
-	paymentError := Payment(&payment)
-	if paymentError != nil {
-		fmt.Println(paymentError, "PAYMENT ERROR 2")
-		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
-			aws.String(paymentError.Error()),
+	// coupon limits are counted per caller, never per the buyer in the body
+	profileId := helpers.CallerProfileId(req)
+	if payment.CouponCode != "" && profileId == "" {
+		return helpers.ApiResponse(http.StatusUnauthorized, ErrorBody{
+			aws.String(ErrorMissingProfile),
 		})
 	}
-	orderError := CreateOrder(payment.Orders)
-	if orderError != nil {
-		fmt.Println(orderError, "PAYMENT ERROR 3")
+	if err := Checkout(profileId, &payment); err != nil {
 		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
-			aws.String(orderError.Error()),
+			aws.String(err.Error()),
 		})
 	}
-	return helpers.ApiResponse(http.StatusCreated, orders)
+	return helpers.ApiResponse(http.StatusCreated, payment.Orders)
 }
 
 // PUT order/{orderId}/updateStatus
@@ -188,9 +193,6 @@ func GetAllOrders(profileId string, statusValues []string) ([]primitive.M, error
 			log.Fatal(e)
 		}
 
-		var book models.Book
-		GetBook(result["book"].(string), &book)
-		result["book"] = book
 		// fmt.Println("cur..>", cur, "result", reflect.TypeOf(result), reflect.TypeOf(result["_id"]))
 		results = append(results, result)
 	}
@@ -200,7 +202,7 @@ func GetAllOrders(profileId string, statusValues []string) ([]primitive.M, error
 	}
 
 	cur.Close(context.Background())
-	return results, nil
+	return results, attachBooks(results)
 }
 
 func GetBook(bookId string, book *models.Book) error {
@@ -241,9 +243,6 @@ func GetAllWaitingOrders(profileId string, statusValues []string) ([]primitive.M
 		if e != nil {
 			log.Fatal(e)
 		}
-		var book models.Book
-		GetBook(result["book"].(string), &book)
-		result["book"] = book
 		//fmt.Println(result, "order waiting")
 		// fmt.Println("cur..>", cur, "result", reflect.TypeOf(result), reflect.TypeOf(result["_id"]))
 		results = append(results, result)
@@ -254,7 +253,83 @@ func GetAllWaitingOrders(profileId string, statusValues []string) ([]primitive.M
 	}
 
 	cur.Close(context.Background())
-	return results, nil
+	return results, attachBooks(results)
+}
+
+// the book fields an order listing shows
+var orderBookProjection = bson.M{
+	"title":         1,
+	"author":        1,
+	"coverimage":    1,
+	"images":        1,
+	"price":         1,
+	"selling_price": 1,
+	"book_type":     1,
+	"condition":     1,
+	"category":      1,
+	"profile":       1,
+	"status":        1,
+}
+
+// attachBooks replaces each order's book id with the book, fetching all of
+// them in one query instead of one per order.
+func attachBooks(orders []primitive.M) error {
+	var bookIds []string
+	for _, order := range orders {
+		if bookId, ok := order["book"].(string); ok {
+			bookIds = append(bookIds, bookId)
+		}
+	}
+	books, err := GetBookSummaries(bookIds)
+	if err != nil {
+		return err
+	}
+	for _, order := range orders {
+		bookId, _ := order["book"].(string)
+		if book, ok := books[bookId]; ok {
+			order["book"] = book
+		} else {
+			order["book"] = bson.M{}
+		}
+	}
+	return nil
+}
+
+// GetBookSummaries fetches the listed books, keyed by id, with only the
+// fields in orderBookProjection.
+func GetBookSummaries(bookIds []string) (map[string]primitive.M, error) {
+	books := map[string]primitive.M{}
+	seen := map[string]bool{}
+	ids := bson.A{}
+	for _, bookId := range bookIds {
+		id, err := primitive.ObjectIDFromHex(bookId)
+		if err != nil || seen[bookId] {
+			continue
+		}
+		seen[bookId] = true
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return books, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cur, err := db.DatabaseObj.Collection("book").Find(ctx, bson.M{"_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(orderBookProjection))
+	if err != nil {
+		return nil, errors.New(ErrorFailedToFetchRecord)
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var book bson.M
+		if err := cur.Decode(&book); err != nil {
+			return nil, errors.New(ErrorFailedToFetchRecord)
+		}
+		books[book["_id"].(primitive.ObjectID).Hex()] = book
+	}
+	return books, cur.Err()
 }
 
 func GetOrder(orderId string, order *models.Order) error {
@@ -271,48 +346,81 @@ func GetOrder(orderId string, order *models.Order) error {
 	return nil
 }
 
-// Insert one order in the DB
+// CreateOrder stores the orders of a checkout, all of them or none: when one
+// can't be stored the ones before it are removed again, so a retried
+// checkout doesn't leave duplicates behind.
 func CreateOrder(orders []models.Order) error {
-	for index, order := range orders {
-		fmt.Println("At index --- ", index, "order value is --- ", order)
+	var inserted []primitive.ObjectID
+	for index := range orders {
+		order := &orders[index]
+		fmt.Println("At index --- ", index, "order value is --- ", *order)
 		order.CreatedAt = time.Now()
 		order.UpdatedAt = time.Now()
+		order.DeliveryDate = models.Date{Time: EstimateDeliveryDate(*order)}
 		insertResult, err := db.DatabaseObj.Collection("order").InsertOne(context.Background(), order)
 		if err != nil {
+			if len(inserted) > 0 {
+				_, err := db.DatabaseObj.Collection("order").DeleteMany(context.Background(), bson.M{"_id": bson.M{"$in": inserted}})
+				if err != nil {
+					fmt.Println(err, "COULD NOT REMOVE PARTIAL ORDERS", inserted)
+				}
+			}
 			return errors.New(ErrorCouldNotUpdateItem)
 		}
 		fmt.Println("Inserted a Single Record ", insertResult.InsertedID, *insertResult)
 
-		order.ID, _ = primitive.ObjectIDFromHex(insertResult.InsertedID.(primitive.ObjectID).Hex())
-
-		var book models.Book
-		UpdateBookQuantityAfterOrder(order.Book, book, order.Quantity)
+		order.ID = insertResult.InsertedID.(primitive.ObjectID)
+		inserted = append(inserted, order.ID)
+	}
+	for _, order := range orders {
+		NotifyOrderPlaced(order)
 	}
 	return nil
 }
 
-func UpdateBookQuantityAfterOrder(bookId string, book models.Book, orderedQuantity int64) error {
-	fmt.Println(bookId)
-	id, _ := primitive.ObjectIDFromHex(bookId)
+// ReserveStock takes the ordered copies of every book off its stock before
+// the customer is charged. The stock check is part of the filter, so two
+// checkouts at once can't both take the last copies. When one book is short
+// the copies already taken are put back.
+func ReserveStock(orders []models.Order) error {
+	for index, order := range orders {
+		if err := changeStock(order.Book, -order.Quantity); err != nil {
+			ReleaseStock(orders[:index])
+			return err
+		}
+	}
+	return nil
+}
 
-	// GET BOOK BY ID
-	ctx, _ := context.WithTimeout(context.Background(), 30*time.Second)
-	err := db.DatabaseObj.Collection("book").FindOne(ctx, bson.M{"_id": id}).Decode(&book)
-	if err != nil {
-		return errors.New(ErrorFailedToFetchRecord)
+// ReleaseStock puts back the copies taken by ReserveStock when the checkout
+// fails.
+func ReleaseStock(orders []models.Order) {
+	for _, order := range orders {
+		if err := changeStock(order.Book, order.Quantity); err != nil {
+			fmt.Println(err, "COULD NOT RELEASE STOCK", order.Book, order.Quantity)
+		}
 	}
+}
 
-	bookQuantity := book.StocksLeft
+// changeStock moves stocks_left by delta, never below zero, and derives
+// in_stock in the same update.
+func changeStock(bookId string, delta int64) error {
+	id, _ := primitive.ObjectIDFromHex(bookId)
 	filter := bson.M{"_id": id}
-	fmt.Println(bookQuantity-orderedQuantity > 0, bookQuantity, orderedQuantity, "PRINTING QUANTITRIES")
-	finalQuantity := bookQuantity - orderedQuantity
-	update := bson.M{"$set": bson.M{"stocksleft": finalQuantity, "instock": bookQuantity-orderedQuantity > 0}}
+	if delta < 0 {
+		filter["stocks_left"] = bson.M{"$gte": -delta}
+	}
+	update := bson.A{
+		bson.M{"$set": bson.M{"stocks_left": bson.M{"$add": bson.A{"$stocks_left", delta}}}},
+		bson.M{"$set": bson.M{"in_stock": bson.M{"$gt": bson.A{"$stocks_left", 0}}}},
+	}
 	result, err := db.DatabaseObj.Collection("book").UpdateOne(context.Background(), filter, update)
 	if err != nil {
 		return errors.New(ErrorCouldNotUpdateItem)
 	}
-
-	fmt.Println("modified count: ", result, result.ModifiedCount)
+	if result.MatchedCount == 0 {
+		return errors.New(ErrorInsufficientStock)
+	}
 	return nil
 }
 
@@ -321,18 +429,25 @@ func UpdateOrderStatus(orderId string, order models.Order) error {
 	fmt.Println(orderId)
 	id, _ := primitive.ObjectIDFromHex(orderId)
 	filter := bson.M{"_id": id}
-	update := bson.M{"$set": bson.M{
-		"status":       order.Status,
-		"deliverydate": order.DeliveryDate,
-		"updated_at":   time.Now(),
-	},
+	fields := bson.M{
+		"status":     order.Status,
+		"updated_at": time.Now(),
 	}
+	// the estimate is computed when the order is placed, sellers may only
+	// move it to another date
+	if !order.DeliveryDate.IsZero() {
+		fields["delivery_date"] = order.DeliveryDate
+	}
+	update := bson.M{"$set": fields}
 	result, err := db.DatabaseObj.Collection("order").UpdateOne(context.Background(), filter, update)
 	if err != nil {
 		return errors.New(ErrorCouldNotUpdateItem)
 	}
 
 	fmt.Println("modified count: ", result.ModifiedCount)
+	if result.ModifiedCount > 0 {
+		NotifyOrderStatus(orderId)
+	}
 	return nil
 }
 
@@ -358,12 +473,18 @@ func Payment(payment *dtos.Payment) error {
 	apiKey := "sk_test_dp3Wxv3ZhwxyQvwxks34udKh005Ueb8ZLy"
 	fmt.Println(apiKey + "asdasd")
 	stripe.Key = apiKey
-	_, err := charge.New(&stripe.ChargeParams{
+	params := &stripe.ChargeParams{
 		Amount:       stripe.Int64(payment.TotalAmount),
 		Currency:     stripe.String(string(stripe.CurrencyINR)),
 		Description:  stripe.String(payment.Description),
 		Source:       &stripe.SourceParams{Token: stripe.String(payment.StripeToken)},
-		ReceiptEmail: stripe.String(payment.ReceiptEmail)})
+		ReceiptEmail: stripe.String(payment.ReceiptEmail)}
+	// Stripe answers a charge with the same key with the first result
+	// instead of charging again
+	if payment.IdempotencyKey != "" {
+		params.SetIdempotencyKey(payment.IdempotencyKey)
+	}
+	_, err := charge.New(params)
 
 	return err
 }
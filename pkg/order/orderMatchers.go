@@ -19,11 +19,19 @@ func MatchRouteOrder(req events.APIGatewayProxyRequest) (*events.APIGatewayProxy
 			return GetAllWaitingOrdersHandler(req)
 		} else if req.Resource == "/order/{orderId}" {
 			return GetOrderHandler(req)
+		} else if req.Resource == "/order/{orderId}/invoice" {
+			return GetInvoiceHandler(req)
+		} else if req.Resource == "/seller/{profileId}/analytics" {
+			return GetSellerAnalyticsHandler(req)
 		} else {
 			return helpers.UnhandledMethod()
 		}
 	case "POST":
-		return CreateOrderHandler(req)
+		if req.Resource == "/cart/checkout" {
+			return CartCheckoutHandler(req)
+		} else {
+			return CreateOrderHandler(req)
+		}
 	case "PUT":
 		return UpdateOrderStatusHandler(req)
 	case "DELETE":
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"the-book-store/db"
+	"the-book-store/helpers"
+	"the-book-store/models"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const BookStatusActive = "ACTIVE"
+
+var (
+	ErrorMissingProfile    = "missing X-Profile-Id header"
+	ErrorBookNotFound      = "book not found"
+	ErrorBookNotSold       = "book is no longer sold"
+	ErrorInvalidQuantity   = "invalid quantity"
+	ErrorInsufficientStock = "not enough stock left"
+	ErrorNotInCart         = "book is not in the cart"
+)
+
+const (
+	CartWarningPriceChanged        = "PRICE_CHANGED"
+	CartWarningReducedAvailability = "REDUCED_AVAILABILITY"
+	CartWarningNoLongerSold        = "NO_LONGER_SOLD"
+)
+
+// GET cart/
+func GetCartHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := helpers.CallerProfileId(req)
+	if profileId == "" {
+		return helpers.ApiResponse(http.StatusUnauthorized, ErrorBody{
+			aws.String(ErrorMissingProfile),
+		})
+	}
+	cart, err := GetCart(profileId)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, cart)
+}
+
+// POST cart/items
+func AddCartItemHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := helpers.CallerProfileId(req)
+	if profileId == "" {
+		return helpers.ApiResponse(http.StatusUnauthorized, ErrorBody{
+			aws.String(ErrorMissingProfile),
+		})
+	}
+	var item models.CartItem
+	if err := json.Unmarshal([]byte(req.Body), &item); err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	cart, err := AddCartItem(profileId, item)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusCreated, cart)
+}
+
+// PATCH cart/items/{bookId}
+func UpdateCartItemHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := helpers.CallerProfileId(req)
+	if profileId == "" {
+		return helpers.ApiResponse(http.StatusUnauthorized, ErrorBody{
+			aws.String(ErrorMissingProfile),
+		})
+	}
+	var item models.CartItem
+	if err := json.Unmarshal([]byte(req.Body), &item); err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	bookId := req.PathParameters["bookId"]
+	cart, err := UpdateCartItem(profileId, bookId, item.Quantity)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, cart)
+}
+
+// DELETE cart/items/{bookId}
+func DeleteCartItemHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := helpers.CallerProfileId(req)
+	if profileId == "" {
+		return helpers.ApiResponse(http.StatusUnauthorized, ErrorBody{
+			aws.String(ErrorMissingProfile),
+		})
+	}
+	bookId := req.PathParameters["bookId"]
+	cart, err := DeleteCartItem(profileId, bookId)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, cart)
+}
+
+func GetCart(profileId string) (models.Cart, error) {
+	var profile models.Profile
+	if err := GetProfile(profileId, &profile); err != nil {
+		return models.Cart{}, err
+	}
+	return cartOf(profile), nil
+}
+
+// AddCartItem puts a book in the cart, adding to the quantity already there.
+func AddCartItem(profileId string, item models.CartItem) (models.Cart, error) {
+	var profile models.Profile
+	if err := GetProfile(profileId, &profile); err != nil {
+		return models.Cart{}, err
+	}
+
+	cart := profile.Cart
+	index := findCartItem(cart, item.Book)
+	if index >= 0 {
+		item.Quantity += cart[index].Quantity
+		item.ID = cart[index].ID
+	} else {
+		item.ID = primitive.NewObjectID()
+	}
+	if err := ValidateCartItem(&item); err != nil {
+		return models.Cart{}, err
+	}
+	if index >= 0 {
+		cart[index] = item
+	} else {
+		cart = append(cart, item)
+	}
+
+	if err := UpdateCart(profileId, cart); err != nil {
+		return models.Cart{}, err
+	}
+	profile.Cart = cart
+	return cartOf(profile), nil
+}
+
+// UpdateCartItem sets the quantity of a book already in the cart.
+func UpdateCartItem(profileId string, bookId string, quantity int64) (models.Cart, error) {
+	var profile models.Profile
+	if err := GetProfile(profileId, &profile); err != nil {
+		return models.Cart{}, err
+	}
+
+	index := findCartItem(profile.Cart, bookId)
+	if index < 0 {
+		return models.Cart{}, errors.New(ErrorNotInCart)
+	}
+	item := profile.Cart[index]
+	item.Quantity = quantity
+	if err := ValidateCartItem(&item); err != nil {
+		return models.Cart{}, err
+	}
+	profile.Cart[index] = item
+
+	if err := UpdateCart(profileId, profile.Cart); err != nil {
+		return models.Cart{}, err
+	}
+	return cartOf(profile), nil
+}
+
+func DeleteCartItem(profileId string, bookId string) (models.Cart, error) {
+	var profile models.Profile
+	if err := GetProfile(profileId, &profile); err != nil {
+		return models.Cart{}, err
+	}
+
+	index := findCartItem(profile.Cart, bookId)
+	if index < 0 {
+		return models.Cart{}, errors.New(ErrorNotInCart)
+	}
+	profile.Cart = append(profile.Cart[:index], profile.Cart[index+1:]...)
+
+	if err := UpdateCart(profileId, profile.Cart); err != nil {
+		return models.Cart{}, err
+	}
+	return cartOf(profile), nil
+}
+
+// ValidateCartItems checks a whole cart sent by the client, merging repeated
+// books into one line.
+func ValidateCartItems(items []models.CartItem) ([]models.CartItem, error) {
+	var cart []models.CartItem
+	for _, item := range items {
+		if index := findCartItem(cart, item.Book); index >= 0 {
+			cart[index].Quantity += item.Quantity
+			continue
+		}
+		if item.ID.IsZero() {
+			item.ID = primitive.NewObjectID()
+		}
+		cart = append(cart, item)
+	}
+	for index := range cart {
+		if err := ValidateCartItem(&cart[index]); err != nil {
+			return nil, err
+		}
+	}
+	return cart, nil
+}
+
+// ValidateCartItem checks the book can still be bought in that quantity and
+// takes the price from the book rather than from the client.
+func ValidateCartItem(item *models.CartItem) error {
+	var book models.Book
+	if err := GetBook(item.Book, &book); err != nil {
+		return errors.New(ErrorBookNotFound)
+	}
+	if book.Status != BookStatusActive {
+		return fmt.Errorf("%s: %s", ErrorBookNotSold, book.Title)
+	}
+	if item.Quantity < 1 {
+		return errors.New(ErrorInvalidQuantity)
+	}
+	if item.Quantity > book.StocksLeft {
+		return fmt.Errorf("%s: %s", ErrorInsufficientStock, book.Title)
+	}
+	item.Amount = book.SellingPrice
+	item.UpdatedAt = time.Now()
+	return nil
+}
+
+func findCartItem(cart []models.CartItem, bookId string) int {
+	for index, item := range cart {
+		if item.Book == bookId {
+			return index
+		}
+	}
+	return -1
+}
+
+// cartOf builds the cart response of a profile, checking every item against
+// the book as it is now so the buyer is not surprised at checkout.
+func cartOf(profile models.Profile) models.Cart {
+	cart := models.Cart{
+		ID:        profile.ID,
+		Profile:   profile.ID.Hex(),
+		CartItems: []*models.CartItem{},
+		Warnings:  []models.CartWarning{},
+		CreatedAt: profile.CreatedAt,
+		UpdatedAt: profile.UpdatedAt,
+	}
+	for index := range profile.Cart {
+		cart.CartItems = append(cart.CartItems, &profile.Cart[index])
+	}
+	RevalidateCart(&cart)
+	return cart
+}
+
+// RevalidateCart compares the stored items with the current books, adding a
+// warning for every change and recomputing the sub total from what can
+// actually be bought now. The stored cart is left untouched.
+func RevalidateCart(cart *models.Cart) {
+	var bookIds []string
+	for _, item := range cart.CartItems {
+		bookIds = append(bookIds, item.Book)
+	}
+	books, err := GetBooksById(bookIds)
+	if err != nil {
+		fmt.Println(err, "COULD NOT REVALIDATE CART")
+		return
+	}
+
+	cart.SubTotal = 0
+	for _, item := range cart.CartItems {
+		book, ok := books[item.Book]
+		if !ok || book.Status != BookStatusActive {
+			cart.Warnings = append(cart.Warnings, models.CartWarning{
+				Book:    item.Book,
+				Code:    CartWarningNoLongerSold,
+				Message: "this book is no longer sold",
+			})
+			continue
+		}
+
+		if book.SellingPrice != item.Amount {
+			cart.Warnings = append(cart.Warnings, models.CartWarning{
+				Book:      item.Book,
+				Code:      CartWarningPriceChanged,
+				Message:   fmt.Sprintf("price changed from %.2f to %.2f", item.Amount, book.SellingPrice),
+				OldAmount: item.Amount,
+				NewAmount: book.SellingPrice,
+				Available: book.StocksLeft,
+			})
+		}
+
+		quantity := item.Quantity
+		if quantity > book.StocksLeft {
+			cart.Warnings = append(cart.Warnings, models.CartWarning{
+				Book:      item.Book,
+				Code:      CartWarningReducedAvailability,
+				Message:   fmt.Sprintf("only %d left in stock", book.StocksLeft),
+				Available: book.StocksLeft,
+			})
+			quantity = book.StocksLeft
+		}
+		cart.SubTotal += book.SellingPrice * float64(quantity)
+	}
+	cart.SubTotal = math.Round(cart.SubTotal*100) / 100
+}
+
+// GetBooksById loads several books in one query, keyed by their id.
+func GetBooksById(bookIds []string) (map[string]models.Book, error) {
+	var ids []primitive.ObjectID
+	for _, bookId := range bookIds {
+		id, _ := primitive.ObjectIDFromHex(bookId)
+		ids = append(ids, id)
+	}
+
+	books := map[string]models.Book{}
+	if len(ids) == 0 {
+		return books, nil
+	}
+	cur, err := db.DatabaseObj.Collection("book").Find(context.Background(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, errors.New(ErrorFailedToFetchRecord)
+	}
+	defer cur.Close(context.Background())
+
+	for cur.Next(context.Background()) {
+		var book models.Book
+		if err := cur.Decode(&book); err != nil {
+			return nil, errors.New(ErrorFailedToFetchRecord)
+		}
+		books[book.ID.Hex()] = book
+	}
+	return books, cur.Err()
+}
+
+func GetBook(bookId string, book *models.Book) error {
+	id, _ := primitive.ObjectIDFromHex(bookId)
+	fmt.Println("Object id", id, bookId)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := db.DatabaseObj.Collection("book").FindOne(ctx, bson.M{"_id": id}).Decode(book)
+	if err != nil {
+		return errors.New(ErrorFailedToFetchRecord)
+	}
+	return nil
+}
@@ -12,6 +12,7 @@ import (
 	"the-book-store/db"
 	"the-book-store/helpers"
 	"the-book-store/models"
+	"the-book-store/storage"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go/aws"
@@ -47,6 +48,7 @@ func GetProfileHandler(req events.APIGatewayProxyRequest) (
 			aws.String(err.Error()),
 		})
 	}
+	profile.UnreadNotifications, _ = GetUnreadNotificationCount(profileId)
 
 	return helpers.ApiResponse(http.StatusOK, profile)
 }
@@ -120,12 +122,18 @@ func UpdateCartHandler(req events.APIGatewayProxyRequest) (
 	error,
 ) {
 
-	var cart []models.CartItem
+	var items []models.CartItem
 	profileId := req.PathParameters["profileId"]
-	if err := json.Unmarshal([]byte(req.Body), &cart); err != nil {
+	if err := json.Unmarshal([]byte(req.Body), &items); err != nil {
 		return nil, errors.New(ErrorInvalidData)
 	}
-	err := UpdateCart(profileId, cart)
+	cart, err := ValidateCartItems(items)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	err = UpdateCart(profileId, cart)
 	if err != nil {
 		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
 			aws.String(err.Error()),
@@ -212,6 +220,17 @@ func GetProfile(profileId string, profile *models.Profile) error {
 	return err
 }
 
+func GetUnreadNotificationCount(profileId string) (int64, error) {
+	count, err := db.DatabaseObj.Collection("notification").CountDocuments(context.Background(), bson.M{
+		"profile": profileId,
+		"read":    false,
+	})
+	if err != nil {
+		return 0, errors.New(ErrorFailedToFetchRecord)
+	}
+	return count, nil
+}
+
 func GetProfileByCognitoId(cognitoId string, profile *models.Profile) error {
 	fmt.Println("Cognito id", cognitoId)
 
@@ -245,12 +264,16 @@ func UpdateProfile(profileId string, profile models.Profile) error {
 	id, _ := primitive.ObjectIDFromHex(profileId)
 	filter := bson.M{"_id": id}
 	update := bson.M{"$set": bson.M{
-		"phone":         profile.Phone,
-		"address1":      profile.Address1,
-		"address2":      profile.Address2,
-		"profile_image": profile.ProfileImage,
-		"pincode":       profile.Pincode,
-		"updated_at":    time.Now(),
+		"phone":                  profile.Phone,
+		"address1":               profile.Address1,
+		"address2":               profile.Address2,
+		"profile_image":          profile.ProfileImage,
+		"profile_image_variants": storage.VariantsOf(profile.ProfileImage),
+		"pincode":                profile.Pincode,
+		"state":                  profile.State,
+		"gstin":                  profile.Gstin,
+		"handling_days":          profile.HandlingDays,
+		"updated_at":             time.Now(),
 	},
 	}
 	result, err := db.DatabaseObj.Collection("profile").UpdateOne(context.Background(), filter, update)
@@ -268,7 +291,8 @@ func UpdateProfileImage(profileId string, profile models.Profile) error {
 	id, _ := primitive.ObjectIDFromHex(profileId)
 	filter := bson.M{"_id": id}
 	update := bson.M{"$set": bson.M{
-		"profile_image": profile.ProfileImage,
+		"profile_image":          profile.ProfileImage,
+		"profile_image_variants": storage.VariantsOf(profile.ProfileImage),
 	},
 	}
 	result, err := db.DatabaseObj.Collection("profile").UpdateOne(context.Background(), filter, update)
@@ -280,12 +304,12 @@ func UpdateProfileImage(profileId string, profile models.Profile) error {
 	return nil
 }
 
-// profile undo method, update profile's status to false
+// replace the stored cart of a profile
 func UpdateCart(profileId string, cart []models.CartItem) error {
 	fmt.Println(profileId)
 	id, _ := primitive.ObjectIDFromHex(profileId)
 	filter := bson.M{"_id": id}
-	update := bson.M{"$set": bson.M{"cart": cart}}
+	update := bson.M{"$set": bson.M{"cart": cart, "updated_at": time.Now()}}
 	result, err := db.DatabaseObj.Collection("profile").UpdateOne(context.Background(), filter, update)
 	if err != nil {
 		return errors.New(ErrorCouldNotUpdateItem)
@@ -17,14 +17,30 @@ func MatchRouteProfile(req events.APIGatewayProxyRequest) (*events.APIGatewayPro
 			return GetProfileHandler(req)
 		} else if req.Resource == "/profile/getByCognitoId/{cognitoId}" {
 			return GetProfileByCognitoIdHandler(req)
+		} else if req.Resource == "/profile/{profileId}/wishlist" {
+			return GetWishlistHandler(req)
+		} else if req.Resource == "/cart" {
+			return GetCartHandler(req)
 		} else {
 			return helpers.UnhandledMethod()
 		}
 	case "POST":
-		return CreateProfileHandler(req)
+		if req.Resource == "/cart/items" {
+			return AddCartItemHandler(req)
+		} else if req.Resource == "/profile/{profileId}/wishlist" {
+			return AddToWishlistHandler(req)
+		} else if req.Resource == "/profile/{profileId}/wishlist/moveToCart" {
+			return MoveToCartHandler(req)
+		} else {
+			return CreateProfileHandler(req)
+		}
+	case "PATCH":
+		if req.Resource == "/cart/items/{bookId}" {
+			return UpdateCartItemHandler(req)
+		} else {
+			return helpers.UnhandledMethod()
+		}
 	case "PUT":
-		return UpdateProfileHandler(req)
-	case "PUTS":
 		if req.Resource == "/profile/{profileId}" {
 			return UpdateProfileHandler(req)
 		} else if req.Resource == "/profile/{profileId}/updateCart" {
@@ -35,7 +51,13 @@ func MatchRouteProfile(req events.APIGatewayProxyRequest) (*events.APIGatewayPro
 			return helpers.UnhandledMethod()
 		}
 	case "DELETE":
-		return DeleteProfileHandler(req)
+		if req.Resource == "/cart/items/{bookId}" {
+			return DeleteCartItemHandler(req)
+		} else if req.Resource == "/profile/{profileId}/wishlist" {
+			return RemoveFromWishlistHandler(req)
+		} else {
+			return DeleteProfileHandler(req)
+		}
 	default:
 		fmt.Println("Exiting handler")
 		return helpers.UnhandledMethod()
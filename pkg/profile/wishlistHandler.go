@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"the-book-store/db"
+	"the-book-store/dtos"
+	"the-book-store/helpers"
+	"the-book-store/models"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrorAlreadyInWishlist = "book is already in the wishlist"
+	ErrorNotInWishlist     = "book is not in the wishlist"
+	ErrorProfileNotFound   = "profile not found"
+	ErrorNotAllowed        = "not allowed"
+)
+
+// GET profile/{profileId}/wishlist
+func GetWishlistHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := req.PathParameters["profileId"]
+	if helpers.CallerProfileId(req) != profileId {
+		return helpers.ApiResponse(http.StatusForbidden, ErrorBody{
+			aws.String(ErrorNotAllowed),
+		})
+	}
+	payload, err := GetWishlist(profileId)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, payload)
+}
+
+// POST profile/{profileId}/wishlist
+func AddToWishlistHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := req.PathParameters["profileId"]
+	if helpers.CallerProfileId(req) != profileId {
+		return helpers.ApiResponse(http.StatusForbidden, ErrorBody{
+			aws.String(ErrorNotAllowed),
+		})
+	}
+	var item models.WishlistItem
+	if err := json.Unmarshal([]byte(req.Body), &item); err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	err := AddToWishlist(profileId, item.Book)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusCreated, item.Book)
+}
+
+// DELETE profile/{profileId}/wishlist?bookId=
+func RemoveFromWishlistHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := req.PathParameters["profileId"]
+	if helpers.CallerProfileId(req) != profileId {
+		return helpers.ApiResponse(http.StatusForbidden, ErrorBody{
+			aws.String(ErrorNotAllowed),
+		})
+	}
+	bookId := req.QueryStringParameters["bookId"]
+	err := RemoveFromWishlist(profileId, bookId)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, bookId)
+}
+
+// POST profile/{profileId}/wishlist/moveToCart
+func MoveToCartHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := req.PathParameters["profileId"]
+	if helpers.CallerProfileId(req) != profileId {
+		return helpers.ApiResponse(http.StatusForbidden, ErrorBody{
+			aws.String(ErrorNotAllowed),
+		})
+	}
+	var item models.CartItem
+	if err := json.Unmarshal([]byte(req.Body), &item); err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	cart, err := MoveToCart(profileId, item)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, cart)
+}
+
+// GetWishlist returns the wishlist with the current price and stock of every
+// book, most recently added first.
+func GetWishlist(profileId string) ([]dtos.WishlistEntry, error) {
+	var profile models.Profile
+	if err := GetProfile(profileId, &profile); err != nil {
+		return nil, err
+	}
+
+	var bookIds []string
+	for _, item := range profile.Wishlist {
+		bookIds = append(bookIds, item.Book)
+	}
+	books, err := GetBooksById(bookIds)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []dtos.WishlistEntry{}
+	for index := len(profile.Wishlist) - 1; index >= 0; index-- {
+		item := profile.Wishlist[index]
+		entry := dtos.WishlistEntry{Book: item.Book, AddedAt: item.AddedAt}
+		if book, ok := books[item.Book]; ok {
+			entry.Title = book.Title
+			entry.Author = book.Author
+			entry.CoverImage = book.CoverImage
+			entry.Price = book.Price
+			entry.SellingPrice = book.SellingPrice
+			entry.StocksLeft = book.StocksLeft
+			entry.InStock = book.InStock
+			entry.Available = book.Status == BookStatusActive && book.StocksLeft > 0
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func AddToWishlist(profileId string, bookId string) error {
+	var book models.Book
+	if err := GetBook(bookId, &book); err != nil {
+		return errors.New(ErrorBookNotFound)
+	}
+
+	id, _ := primitive.ObjectIDFromHex(profileId)
+	// the filter skips profiles already holding the book, keeping entries unique
+	filter := bson.M{"_id": id, "wishlist.book": bson.M{"$ne": bookId}}
+	item := models.WishlistItem{
+		Book:    bookId,
+		AddedAt: time.Now(),
+	}
+	// older profiles were stored with wishlist: null, which $push refuses
+	update := bson.A{bson.M{"$set": bson.M{"wishlist": bson.M{"$concatArrays": bson.A{
+		bson.M{"$ifNull": bson.A{"$wishlist", bson.A{}}},
+		bson.A{bson.M{"$literal": item}},
+	}}}}}
+	profiles := db.DatabaseObj.Collection("profile")
+	result, err := profiles.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return errors.New(ErrorCouldNotUpdateItem)
+	}
+	if result.MatchedCount == 0 {
+		count, err := profiles.CountDocuments(context.Background(), bson.M{"_id": id})
+		if err != nil {
+			return errors.New(ErrorCouldNotUpdateItem)
+		}
+		if count == 0 {
+			return errors.New(ErrorProfileNotFound)
+		}
+		return errors.New(ErrorAlreadyInWishlist)
+	}
+	fmt.Println("modified count: ", result.ModifiedCount)
+	return nil
+}
+
+func RemoveFromWishlist(profileId string, bookId string) error {
+	id, _ := primitive.ObjectIDFromHex(profileId)
+	filter := bson.M{"_id": id}
+	update := bson.M{"$pull": bson.M{"wishlist": bson.M{"book": bookId}}}
+	result, err := db.DatabaseObj.Collection("profile").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return errors.New(ErrorCouldNotUpdateItem)
+	}
+	if result.ModifiedCount == 0 {
+		return errors.New(ErrorNotInWishlist)
+	}
+	return nil
+}
+
+// MoveToCart puts a wishlisted book in the cart and takes it off the wishlist.
+func MoveToCart(profileId string, item models.CartItem) (models.Cart, error) {
+	if item.Quantity == 0 {
+		item.Quantity = 1
+	}
+	cart, err := AddCartItem(profileId, item)
+	if err != nil {
+		return models.Cart{}, err
+	}
+	if err := RemoveFromWishlist(profileId, item.Book); err != nil {
+		fmt.Println(err, "MOVED TO CART BUT NOT ON WISHLIST")
+	}
+	return cart, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+
+	"the-book-store/dtos"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	defaultReviewLimit = 20
+	maxReviewLimit     = 100
+)
+
+var (
+	ErrorInvalidSort   = "sort must be one of newest, oldest, highest, lowest or helpful"
+	ErrorInvalidCursor = "invalid cursor"
+)
+
+type sortKey struct {
+	Field string
+	Order int
+}
+
+// Every order ends on _id so reviews written in the same instant still have
+// a fixed position, which the cursor relies on.
+var reviewSorts = map[string][]sortKey{
+	"newest":  {{"created_at", -1}, {"_id", -1}},
+	"oldest":  {{"created_at", 1}, {"_id", 1}},
+	"highest": {{"stars", -1}, {"created_at", -1}, {"_id", -1}},
+	"lowest":  {{"stars", 1}, {"created_at", -1}, {"_id", -1}},
+	"helpful": {{"helpful_count", -1}, {"created_at", -1}, {"_id", -1}},
+}
+
+// reviewQueryFrom reads ?stars=4,5&with_images=true&sort=helpful&cursor=&limit=20
+func reviewQueryFrom(params map[string]string) (dtos.ReviewQuery, error) {
+	query := dtos.ReviewQuery{
+		Sort:   params["sort"],
+		Cursor: params["cursor"],
+		Limit:  defaultReviewLimit,
+	}
+	if query.Sort == "" {
+		query.Sort = "newest"
+	}
+	if _, ok := reviewSorts[query.Sort]; !ok {
+		return query, errors.New(ErrorInvalidSort)
+	}
+	if params["stars"] != "" {
+		for _, s := range strings.Split(params["stars"], ",") {
+			stars, err := strconv.ParseInt(strings.TrimSpace(s), 10, 32)
+			if err != nil || !validStars(int32(stars)) {
+				return query, errors.New(ErrorInvalidStars)
+			}
+			query.Stars = append(query.Stars, int32(stars))
+		}
+	}
+	query.WithImages, _ = strconv.ParseBool(params["with_images"])
+	if limit, err := strconv.ParseInt(params["limit"], 10, 64); err == nil && limit > 0 {
+		query.Limit = limit
+	}
+	if query.Limit > maxReviewLimit {
+		query.Limit = maxReviewLimit
+	}
+	return query, nil
+}
+
+func reviewSort(keys []sortKey) bson.D {
+	sort := bson.D{}
+	for _, key := range keys {
+		sort = append(sort, bson.E{Key: key.Field, Value: key.Order})
+	}
+	return sort
+}
+
+// encodeCursor keeps the sort values of the last review on a page. They are
+// stored as BSON so dates and object ids come back with their own types.
+func encodeCursor(keys []sortKey, last bson.M) string {
+	values := bson.A{}
+	for _, key := range keys {
+		values = append(values, last[key.Field])
+	}
+	raw, err := bson.Marshal(bson.M{"v": values})
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// cursorFilter matches the reviews that sort after the cursor: those past it
+// on the first key, or level on the first key and past it on the next, etc.
+func cursorFilter(keys []sortKey, cursor string) (bson.M, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.New(ErrorInvalidCursor)
+	}
+	var decoded struct {
+		V bson.A `bson:"v"`
+	}
+	if err := bson.Unmarshal(raw, &decoded); err != nil || len(decoded.V) != len(keys) {
+		return nil, errors.New(ErrorInvalidCursor)
+	}
+
+	after := bson.A{}
+	for i, key := range keys {
+		condition := bson.M{}
+		for j := 0; j < i; j++ {
+			condition[keys[j].Field] = decoded.V[j]
+		}
+		op := "$gt"
+		if key.Order < 0 {
+			op = "$lt"
+		}
+		condition[key.Field] = bson.M{op: decoded.V[i]}
+		after = append(after, condition)
+	}
+	return bson.M{"$or": after}, nil
+}
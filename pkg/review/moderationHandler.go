@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"the-book-store/db"
+	"the-book-store/helpers"
+	"the-book-store/models"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ReviewStatusPending   = models.ReviewStatusPending
+	ReviewStatusPublished = models.ReviewStatusPublished
+	ReviewStatusHidden    = models.ReviewStatusHidden
+)
+
+// a published review with this many open reports goes back to the queue
+const ReportThreshold = 3
+
+var ReportReasons = map[string]bool{
+	"SPAM":      true,
+	"OFFENSIVE": true,
+	"OFF_TOPIC": true,
+	"FAKE":      true,
+	"OTHER":     true,
+}
+
+var (
+	ErrorNotAllowed        = "not allowed"
+	ErrorInvalidReason     = "reason must be one of SPAM, OFFENSIVE, OFF_TOPIC, FAKE or OTHER"
+	ErrorAlreadyReported   = "you have already reported this review"
+	ErrorInvalidModeration = "status must be PUBLISHED or HIDDEN"
+)
+
+// Reviews in these statuses are kept out of listings and ratings. Reviews
+// written before moderation existed have no status and stay visible.
+var unpublishedStatuses = models.UnpublishedReviewStatuses
+
+func isPublished(status string) bool {
+	return status == "" || status == ReviewStatusPublished
+}
+
+var blockedWords = []string{
+	"fuck", "shit", "bitch", "bastard", "asshole", "dick", "cunt",
+	"chutiya", "madarchod", "behenchod", "bhosdi", "gaandu",
+}
+
+// linkPattern finds links: a scheme or www. in any case, or a lower case
+// domain. Prose like "book.In short" starts a sentence with a capital, and
+// the .in and .co domains only count with a path, as "in" and "co" are too
+// common to take on their own.
+var linkPattern = regexp.MustCompile(`(?i:https?://|www\.)|\b[a-z0-9-]+\.(com|net|org|io|xyz|info|biz|ly)\b|\b[a-z0-9-]+\.(in|co)/`)
+
+// FlagContent returns why a review text needs a moderator before it is
+// published, or "" when it can go out straight away. REVIEW_BLOCKED_WORDS
+// adds comma separated words to the built-in list.
+func FlagContent(content string) string {
+	if linkPattern.MatchString(content) {
+		return "contains a link"
+	}
+	words := blockedWords
+	if extra := os.Getenv("REVIEW_BLOCKED_WORDS"); extra != "" {
+		words = append(append([]string{}, words...), strings.Split(extra, ",")...)
+	}
+	text := strings.ToLower(content)
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}) {
+		for _, blocked := range words {
+			if word == strings.ToLower(strings.TrimSpace(blocked)) {
+				return "contains blocked language"
+			}
+		}
+	}
+	return ""
+}
+
+// POST review/{reviewId}/report
+func ReportReviewHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := helpers.CallerProfileId(req)
+	if profileId == "" {
+		return helpers.ApiResponse(http.StatusUnauthorized, ErrorBody{
+			aws.String(ErrorMissingProfile),
+		})
+	}
+	var report models.ReviewReport
+	if err := json.Unmarshal([]byte(req.Body), &report); err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	report.Profile = profileId
+	report.Review = req.PathParameters["reviewId"]
+	err := ReportReview(&report)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusCreated, report)
+}
+
+// GET review/moderation
+func GetModerationQueueHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	if !helpers.IsAdmin(helpers.CallerProfileId(req)) {
+		return helpers.ApiResponse(http.StatusForbidden, ErrorBody{
+			aws.String(ErrorNotAllowed),
+		})
+	}
+	payload, err := GetModerationQueue()
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, payload)
+}
+
+// PUT review/{reviewId}/moderate
+func ModerateReviewHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	adminId := helpers.CallerProfileId(req)
+	if !helpers.IsAdmin(adminId) {
+		return helpers.ApiResponse(http.StatusForbidden, ErrorBody{
+			aws.String(ErrorNotAllowed),
+		})
+	}
+	var body models.Review
+	if err := json.Unmarshal([]byte(req.Body), &body); err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	review, err := ModerateReview(req.PathParameters["reviewId"], body.Status, adminId)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, review)
+}
+
+// ReportReview files a report, one per profile per review. Enough open
+// reports pull a published review back into the moderation queue.
+func ReportReview(report *models.ReviewReport) error {
+	report.Reason = strings.ToUpper(strings.TrimSpace(report.Reason))
+	if !ReportReasons[report.Reason] {
+		return errors.New(ErrorInvalidReason)
+	}
+	var review models.Review
+	if err := GetReview(report.Review, &review); err != nil {
+		return errors.New(ErrorReviewNotFound)
+	}
+
+	count, err := db.DatabaseObj.Collection("review_report").CountDocuments(context.Background(),
+		bson.M{"review": report.Review, "profile": report.Profile})
+	if err != nil {
+		return errors.New(ErrorFailedToFetchRecord)
+	}
+	if count > 0 {
+		return errors.New(ErrorAlreadyReported)
+	}
+
+	report.Resolved = false
+	report.CreatedAt = time.Now()
+	// two reports at once both pass the count, the unique (review, profile)
+	// index lets only one of them in
+	insertResult, err := db.DatabaseObj.Collection("review_report").InsertOne(context.Background(), report)
+	if mongo.IsDuplicateKeyError(err) {
+		return errors.New(ErrorAlreadyReported)
+	}
+	if err != nil {
+		return errors.New(ErrorCouldNotUpdateItem)
+	}
+	report.ID = insertResult.InsertedID.(primitive.ObjectID)
+
+	id, _ := primitive.ObjectIDFromHex(report.Review)
+	err = db.DatabaseObj.Collection("review").FindOneAndUpdate(context.Background(), bson.M{"_id": id},
+		bson.M{"$inc": bson.M{"report_count": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&review)
+	if err != nil {
+		return errors.New(ErrorCouldNotUpdateItem)
+	}
+
+	if review.ReportCount >= ReportThreshold && isPublished(review.Status) {
+		setReviewStatus(review, ReviewStatusPending, "reported by buyers", "")
+	}
+	return nil
+}
+
+// GetModerationQueue lists reviews waiting for a moderator: those held by
+// the content filter and those with open reports, most reported first.
+func GetModerationQueue() ([]primitive.M, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "report_count", Value: -1}, {Key: "created_at", Value: 1}})
+	cur, err := db.DatabaseObj.Collection("review").Find(context.Background(), bson.M{
+		"$or": bson.A{
+			bson.M{"status": ReviewStatusPending},
+			bson.M{"report_count": bson.M{"$gt": 0}},
+		},
+	}, opts)
+	if err != nil {
+		return nil, errors.New(ErrorFailedToFetchRecord)
+	}
+	defer cur.Close(context.Background())
+
+	results := []primitive.M{}
+	for cur.Next(context.Background()) {
+		var result bson.M
+		if err := cur.Decode(&result); err != nil {
+			return nil, errors.New(ErrorFailedToFetchRecord)
+		}
+		reports, err := getOpenReports(result["_id"].(primitive.ObjectID).Hex())
+		if err != nil {
+			return nil, err
+		}
+		result["reports"] = reports
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// deleteReports drops the reports filed on a deleted review.
+func deleteReports(reviewId string) {
+	_, err := db.DatabaseObj.Collection("review_report").DeleteMany(context.Background(), bson.M{"review": reviewId})
+	if err != nil {
+		fmt.Println(err, "COULD NOT DELETE REVIEW REPORTS")
+	}
+}
+
+func getOpenReports(reviewId string) ([]models.ReviewReport, error) {
+	reports := []models.ReviewReport{}
+	cur, err := db.DatabaseObj.Collection("review_report").Find(context.Background(),
+		bson.M{"review": reviewId, "resolved": false})
+	if err != nil {
+		return nil, errors.New(ErrorFailedToFetchRecord)
+	}
+	if err := cur.All(context.Background(), &reports); err != nil {
+		return nil, errors.New(ErrorFailedToFetchRecord)
+	}
+	return reports, nil
+}
+
+// ModerateReview publishes or hides a review and closes its open reports.
+func ModerateReview(reviewId string, status string, adminId string) (models.Review, error) {
+	var review models.Review
+	if status != ReviewStatusPublished && status != ReviewStatusHidden {
+		return review, errors.New(ErrorInvalidModeration)
+	}
+	if err := GetReview(reviewId, &review); err != nil {
+		return review, errors.New(ErrorReviewNotFound)
+	}
+
+	updated, err := setReviewStatus(review, status, "", adminId)
+	if err != nil {
+		return review, err
+	}
+	_, err = db.DatabaseObj.Collection("review_report").UpdateMany(context.Background(),
+		bson.M{"review": reviewId, "resolved": false}, bson.M{"$set": bson.M{"resolved": true}})
+	if err != nil {
+		fmt.Println(err, "COULD NOT RESOLVE REVIEW REPORTS")
+	}
+
+	// the seller hears about a held review once it is let through
+	if review.Status == ReviewStatusPending && status == ReviewStatusPublished {
+		NotifyNewReview(updated)
+	}
+	return updated, nil
+}
+
+// setReviewStatus moves a review between statuses and keeps the book's
+// rating in line, since only published reviews count towards it. A
+// moderator's decision also clears the report counter.
+func setReviewStatus(review models.Review, status string, reason string, adminId string) (models.Review, error) {
+	set := bson.M{"status": status, "flagged_reason": reason, "updated_at": time.Now()}
+	if adminId != "" {
+		set["moderated_by"] = adminId
+		set["moderated_at"] = time.Now()
+		set["report_count"] = 0
+	}
+	var updated models.Review
+	err := db.DatabaseObj.Collection("review").FindOneAndUpdate(context.Background(), bson.M{"_id": review.ID},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return updated, errors.New(ErrorReviewNotFound)
+	}
+	if err != nil {
+		return updated, errors.New(ErrorCouldNotUpdateItem)
+	}
+
+	was, is := isPublished(review.Status), isPublished(status)
+	if was && !is {
+		AdjustBookRating(review.Book, review.Stars, 0)
+	} else if !was && is {
+		AdjustBookRating(review.Book, 0, review.Stars)
+	}
+	return updated, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"the-book-store/db"
+	"the-book-store/dtos"
+	"the-book-store/helpers"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// book fields holding the count of reviews for each star rating
+var starFields = map[int32]string{
+	5: "five_star",
+	4: "four_star",
+	3: "three_star",
+	2: "two_star",
+	1: "one_star",
+}
+
+func validStars(stars int32) bool {
+	_, ok := starFields[stars]
+	return ok
+}
+
+// AdjustBookRating moves a book's rating aggregates by one review. Pass the
+// stars removed (0 for none) and the stars added (0 for none): an insert is
+// (0, new), a delete is (old, 0) and an edit is (old, new). Stars outside 1
+// to 5, which older reviews may hold, still count towards the review count
+// and total but have no star counter to move.
+func AdjustBookRating(bookId string, removed int32, added int32) error {
+	if removed == added {
+		return nil
+	}
+	var count, total int32
+	inc := bson.M{}
+	if removed != 0 {
+		count--
+		total -= removed
+		if validStars(removed) {
+			inc[starFields[removed]] = -1
+		}
+	}
+	if added != 0 {
+		count++
+		total += added
+		if validStars(added) {
+			inc[starFields[added]] = 1
+		}
+	}
+	inc["review_count"] = count
+	inc["rating_total"] = total
+
+	id, _ := primitive.ObjectIDFromHex(bookId)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err := db.DatabaseObj.Collection("book").UpdateOne(ctx, bson.M{"_id": id},
+		bson.M{"$inc": inc, "$set": bson.M{"updated_at": time.Now()}})
+	if err != nil {
+		fmt.Println(err, "COULD NOT UPDATE BOOK RATING")
+		return err
+	}
+
+	// derive the average from the counters as they are now, so concurrent
+	// reviews settle on the same value whichever update lands last
+	_, err = db.DatabaseObj.Collection("book").UpdateOne(ctx, bson.M{"_id": id}, averageRatingPipeline)
+	if err != nil {
+		fmt.Println(err, "COULD NOT UPDATE BOOK AVERAGE RATING")
+	}
+	return err
+}
+
+var averageRatingPipeline = bson.A{
+	bson.M{"$set": bson.M{"average_rating": bson.M{"$cond": bson.A{
+		bson.M{"$gt": bson.A{"$review_count", 0}},
+		bson.M{"$round": bson.A{bson.M{"$divide": bson.A{"$rating_total", "$review_count"}}, 1}},
+		0,
+	}}}},
+}
+
+// GET review/stats/{bookId}
+func GetReviewStatsHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+	bookId := req.PathParameters["bookId"]
+	stats, err := GetReviewStats(bookId)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, stats)
+}
+
+func starCount(stars int32) bson.M {
+	return bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$stars", stars}}, 1, 0}}}
+}
+
+// GetReviewStats counts, averages and buckets a book's reviews in a single
+// aggregation.
+func GetReviewStats(bookId string) (dtos.ReviewStats, error) {
+	stats := dtos.ReviewStats{Book: bookId}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cur, err := db.DatabaseObj.Collection("review").Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"book": bookId, "status": bson.M{"$nin": unpublishedStatuses}}},
+		bson.M{"$group": bson.M{
+			"_id":        nil,
+			"count":      bson.M{"$sum": 1},
+			"average":    bson.M{"$avg": "$stars"},
+			"five_star":  starCount(5),
+			"four_star":  starCount(4),
+			"three_star": starCount(3),
+			"two_star":   starCount(2),
+			"one_star":   starCount(1),
+		}},
+	})
+	if err != nil {
+		return stats, errors.New(ErrorFailedToFetchRecord)
+	}
+	defer cur.Close(ctx)
+
+	// no reviews means no group, and zero stats
+	if cur.Next(ctx) {
+		if err := cur.Decode(&stats); err != nil {
+			return stats, errors.New(ErrorFailedToFetchRecord)
+		}
+	}
+	stats.Book = bookId
+	stats.Average = math.Round(stats.Average*10) / 10
+	return stats, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"the-book-store/db"
+	"the-book-store/helpers"
+	"the-book-store/models"
+	"the-book-store/notifications"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const ReplyMaxLength = 2000
+
+var (
+	ErrorNotBookSeller = "only the seller of the book can reply to its reviews"
+	ErrorEmptyReply    = "reply can't be empty"
+	ErrorReplyTooLong  = "reply can't be longer than 2000 characters"
+	ErrorReplyFlagged  = "reply can't be posted, it "
+	ErrorReplyExists   = "this review already has a reply"
+	ErrorReplyNotFound = "this review has no reply"
+)
+
+// POST review/{reviewId}/reply
+func CreateReplyHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+	return replyHandler(req, http.StatusCreated, CreateReply)
+}
+
+// PUT review/{reviewId}/reply
+func UpdateReplyHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+	return replyHandler(req, http.StatusOK, UpdateReply)
+}
+
+// DELETE review/{reviewId}/reply
+func DeleteReplyHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := helpers.CallerProfileId(req)
+	if profileId == "" {
+		return helpers.ApiResponse(http.StatusUnauthorized, ErrorBody{
+			aws.String(ErrorMissingProfile),
+		})
+	}
+	review, err := DeleteReply(req.PathParameters["reviewId"], profileId)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, review)
+}
+
+func replyHandler(req events.APIGatewayProxyRequest, status int,
+	save func(reviewId string, reply models.ReviewReply) (models.Review, error)) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := helpers.CallerProfileId(req)
+	if profileId == "" {
+		return helpers.ApiResponse(http.StatusUnauthorized, ErrorBody{
+			aws.String(ErrorMissingProfile),
+		})
+	}
+	var reply models.ReviewReply
+	if err := json.Unmarshal([]byte(req.Body), &reply); err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	reply.Profile = profileId
+	review, err := save(req.PathParameters["reviewId"], reply)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(status, review)
+}
+
+// checkReply makes sure the reply comes from the book's seller and is fit to
+// publish. Replies skip the moderation queue, so anything the content filter
+// would hold is refused outright.
+func checkReply(reviewId string, reply *models.ReviewReply) (models.Review, error) {
+	var review models.Review
+	if err := GetReview(reviewId, &review); err != nil {
+		return review, errors.New(ErrorReviewNotFound)
+	}
+	var book models.Book
+	if err := GetBook(review.Book, &book); err != nil {
+		return review, errors.New(ErrorBookNotFound)
+	}
+	if book.Profile != reply.Profile {
+		return review, errors.New(ErrorNotBookSeller)
+	}
+
+	reply.Content = strings.TrimSpace(reply.Content)
+	if reply.Content == "" {
+		return review, errors.New(ErrorEmptyReply)
+	}
+	if len([]rune(reply.Content)) > ReplyMaxLength {
+		return review, errors.New(ErrorReplyTooLong)
+	}
+	if reason := FlagContent(reply.Content); reason != "" {
+		return review, errors.New(ErrorReplyFlagged + reason)
+	}
+	return review, nil
+}
+
+// CreateReply adds the seller's reply. There is one per review; the filter
+// on a missing reply keeps two concurrent posts from both succeeding.
+func CreateReply(reviewId string, reply models.ReviewReply) (models.Review, error) {
+	review, err := checkReply(reviewId, &reply)
+	if err != nil {
+		return review, err
+	}
+	reply.CreatedAt = time.Now()
+	reply.UpdatedAt = time.Now()
+	updated, err := saveReply(review, bson.M{"reply": nil}, bson.M{"$set": bson.M{"reply": reply}}, ErrorReplyExists)
+	if err != nil {
+		return review, err
+	}
+
+	notifications.Store(review.Profile, notifications.ReviewReply, map[string]interface{}{
+		"review": reviewId,
+		"book":   review.Book,
+	})
+	return updated, nil
+}
+
+// UpdateReply changes the text of an existing reply.
+func UpdateReply(reviewId string, reply models.ReviewReply) (models.Review, error) {
+	review, err := checkReply(reviewId, &reply)
+	if err != nil {
+		return review, err
+	}
+	return saveReply(review, bson.M{"reply": bson.M{"$ne": nil}}, bson.M{"$set": bson.M{
+		"reply.content":    reply.Content,
+		"reply.updated_at": time.Now(),
+	}}, ErrorReplyNotFound)
+}
+
+// DeleteReply removes the seller's reply.
+func DeleteReply(reviewId string, profileId string) (models.Review, error) {
+	var review models.Review
+	if err := GetReview(reviewId, &review); err != nil {
+		return review, errors.New(ErrorReviewNotFound)
+	}
+	var book models.Book
+	if err := GetBook(review.Book, &book); err != nil {
+		return review, errors.New(ErrorBookNotFound)
+	}
+	if book.Profile != profileId {
+		return review, errors.New(ErrorNotBookSeller)
+	}
+	return saveReply(review, bson.M{"reply": bson.M{"$ne": nil}}, bson.M{"$unset": bson.M{"reply": ""}}, ErrorReplyNotFound)
+}
+
+func saveReply(review models.Review, condition bson.M, update bson.M, errorIfMissing string) (models.Review, error) {
+	condition["_id"] = review.ID
+	var updated models.Review
+	err := db.DatabaseObj.Collection("review").FindOneAndUpdate(context.Background(), condition, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return review, errors.New(errorIfMissing)
+	}
+	if err != nil {
+		return review, errors.New(ErrorCouldNotUpdateItem)
+	}
+	return updated, nil
+}
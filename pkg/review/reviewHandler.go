@@ -7,17 +7,20 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"reflect"
 	"time"
 
 	"the-book-store/db"
+	"the-book-store/dtos"
 	"the-book-store/helpers"
 	"the-book-store/models"
+	"the-book-store/notifications"
+	"the-book-store/storage"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go/aws"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
@@ -27,8 +30,13 @@ var (
 	ErrorCouldNotMarshalItem     = "could not marshal item"
 	ErrorCouldNotDeleteItem      = "could not delete item"
 	ErrorCouldNotUpdateItem      = "could not update item"
+	ErrorBookNotFound            = "book not found"
+	ErrorNotVerifiedPurchase     = "only buyers of a delivered order can review this book"
+	ErrorInvalidStars            = "stars must be between 1 and 5"
 )
 
+const OrderStatusDelivered = "DELIVERED"
+
 type ErrorBody struct {
 	ErrorMsg *string `json:"error,omitempty"`
 }
@@ -42,13 +50,24 @@ func GetAllReviewsHandler(req events.APIGatewayProxyRequest) (
 	//params := mux.Vars(r)
 	//bookId := r.URL.Query().Get("id")
 	bookId := req.PathParameters["bookId"]
-	payload, err := getAllReviews(bookId)
+	query, err := reviewQueryFrom(req.QueryStringParameters)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	payload, nextCursor, err := getAllReviews(bookId, query)
 	if err != nil {
 		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
 			aws.String(err.Error()),
 		})
 	}
-	return helpers.ApiResponse(http.StatusOK, payload)
+	// the body stays a plain list, the next page is announced in a header
+	resp, err := helpers.ApiResponse(http.StatusOK, payload)
+	if nextCursor != "" {
+		resp.Headers[helpers.NextCursorHeader] = nextCursor
+	}
+	return resp, err
 }
 
 // GET review/{reviewId}
@@ -61,6 +80,13 @@ func GetReviewHandler(req events.APIGatewayProxyRequest) (
 	var review models.Review
 	err := GetReview(reviewIdRaw, &review)
 	fmt.Println("Review", review)
+	// held and hidden reviews are only shown to their author and admins
+	if err == nil && !isPublished(review.Status) {
+		caller := helpers.CallerProfileId(req)
+		if caller != review.Profile && !helpers.IsAdmin(caller) {
+			err = errors.New(ErrorReviewNotFound)
+		}
+	}
 	if err != nil {
 		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
 			aws.String(err.Error()),
@@ -75,12 +101,20 @@ func CreateReviewHandler(req events.APIGatewayProxyRequest) (
 	error,
 ) {
 
+	// the reviewer is always the caller, never a profile named in the body
+	profileId := helpers.CallerProfileId(req)
+	if profileId == "" {
+		return helpers.ApiResponse(http.StatusUnauthorized, ErrorBody{
+			aws.String(ErrorMissingProfile),
+		})
+	}
 	var review models.Review
 	if err := json.Unmarshal([]byte(req.Body), &review); err != nil {
 		return nil, errors.New(ErrorInvalidData)
 	}
+	review.Profile = profileId
 	// fmt.Println(task, r.Body)
-	err := insertReview(review)
+	err := insertReview(&review)
 	if err != nil {
 		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
 			aws.String(err.Error()),
@@ -96,10 +130,15 @@ func UpdateReviewHandler(req events.APIGatewayProxyRequest) (
 ) {
 
 	reviewId := req.PathParameters["reviewId"]
+	if resp, ok := checkReviewAuthor(req, reviewId); !ok {
+		return resp, nil
+	}
 	var review models.Review
 	if err := json.Unmarshal([]byte(req.Body), &review); err != nil {
 		return nil, errors.New(ErrorInvalidData)
 	}
+	// only stars and content are taken from the body, updateReview never
+	// touches verified, the order or the author
 	err := updateReview(reviewId, review)
 	if err != nil {
 		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
@@ -115,6 +154,9 @@ func DeleteReviewHandler(req events.APIGatewayProxyRequest) (
 	error,
 ) {
 	reviewId := req.PathParameters["reviewId"]
+	if resp, ok := checkReviewAuthor(req, reviewId); !ok {
+		return resp, nil
+	}
 	err := deleteReview(reviewId)
 	if err != nil {
 		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
@@ -126,8 +168,29 @@ func DeleteReviewHandler(req events.APIGatewayProxyRequest) (
 
 }
 
-// get all task from the DB and return it
-func getAllReviews(bookId string) ([]primitive.M, error) {
+// checkReviewAuthor lets only the author of a review, or an admin, change
+// it. When not allowed it returns the response to send.
+func checkReviewAuthor(req events.APIGatewayProxyRequest, reviewId string) (*events.APIGatewayProxyResponse, bool) {
+	var review models.Review
+	if err := GetReview(reviewId, &review); err != nil {
+		resp, _ := helpers.ApiResponse(http.StatusNotFound, ErrorBody{
+			aws.String(ErrorReviewNotFound),
+		})
+		return resp, false
+	}
+	caller := helpers.CallerProfileId(req)
+	if caller == "" || caller != review.Profile && !helpers.IsAdmin(caller) {
+		resp, _ := helpers.ApiResponse(http.StatusForbidden, ErrorBody{
+			aws.String(ErrorNotAllowed),
+		})
+		return resp, false
+	}
+	return nil, true
+}
+
+// get one page of a book's published reviews, along with the cursor of the
+// next page ("" on the last one)
+func getAllReviews(bookId string, query dtos.ReviewQuery) ([]primitive.M, string, error) {
 
 	//err := db.DatabaseObj.Collection("book").FindOne(context.Background(), bson.M{{""}})
 
@@ -135,24 +198,47 @@ func getAllReviews(bookId string) ([]primitive.M, error) {
 	//id, _ := primitive.ObjectIDFromHex(bookId)
 	fmt.Println(bookId, "BOOK ID FOR REVIEWS")
 
-	cur, err := db.DatabaseObj.Collection("review").Find(context.Background(), bson.M{"book": bookId})
+	filter := bson.M{
+		"book":   bookId,
+		"status": bson.M{"$nin": unpublishedStatuses},
+	}
+	if len(query.Stars) > 0 {
+		filter["stars"] = bson.M{"$in": query.Stars}
+	}
+	if query.WithImages {
+		filter["images.0"] = bson.M{"$exists": true}
+	}
+	keys := reviewSorts[query.Sort]
+	if query.Cursor != "" {
+		after, err := cursorFilter(keys, query.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		filter["$and"] = bson.A{after}
+	}
+
+	// one extra review tells us whether there is a next page
+	opts := options.Find().SetSort(reviewSort(keys)).SetLimit(query.Limit + 1)
+	cur, err := db.DatabaseObj.Collection("review").Find(context.Background(), filter, opts)
 
 	//GetAllReviewCount(bookId)
 
 	if err != nil {
-		return nil, errors.New(ErrorFailedToFetchRecord)
+		return nil, "", errors.New(ErrorFailedToFetchRecord)
 	}
 
-	var results []primitive.M
+	results := []primitive.M{}
+	nextCursor := ""
 	for cur.Next(context.Background()) {
 		var result bson.M
 		e := cur.Decode(&result)
 		if e != nil {
 			log.Fatal(e)
 		}
-		var profile models.Profile
-		GetProfile(result["profile"].(string), &profile)
-		result["profile"] = profile
+		if int64(len(results)) == query.Limit {
+			nextCursor = encodeCursor(keys, results[len(results)-1])
+			break
+		}
 		// fmt.Println("cur..>", cur, "result", reflect.TypeOf(result), reflect.TypeOf(result["_id"]))
 		results = append(results, result)
 
@@ -163,7 +249,58 @@ func getAllReviews(bookId string) ([]primitive.M, error) {
 	}
 
 	cur.Close(context.Background())
-	return results, nil
+	return results, nextCursor, attachReviewers(results)
+}
+
+// the profile fields shown next to a review; contact details stay private
+var reviewerProjection = bson.M{
+	"username":      1,
+	"profile_image": 1,
+}
+
+// attachReviewers replaces each review's profile id with the reviewer's
+// public profile, fetching all of them in one query.
+func attachReviewers(reviews []primitive.M) error {
+	seen := map[string]bool{}
+	ids := bson.A{}
+	for _, review := range reviews {
+		profileId, _ := review["profile"].(string)
+		id, err := primitive.ObjectIDFromHex(profileId)
+		if err != nil || seen[profileId] {
+			continue
+		}
+		seen[profileId] = true
+		ids = append(ids, id)
+	}
+
+	profiles := map[string]primitive.M{}
+	if len(ids) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		cur, err := db.DatabaseObj.Collection("profile").Find(ctx, bson.M{"_id": bson.M{"$in": ids}},
+			options.Find().SetProjection(reviewerProjection))
+		if err != nil {
+			return errors.New(ErrorFailedToFetchRecord)
+		}
+		defer cur.Close(ctx)
+		for cur.Next(ctx) {
+			var profile bson.M
+			if err := cur.Decode(&profile); err != nil {
+				return errors.New(ErrorFailedToFetchRecord)
+			}
+			profiles[profile["_id"].(primitive.ObjectID).Hex()] = profile
+		}
+	}
+
+	for _, review := range reviews {
+		profileId, _ := review["profile"].(string)
+		if profile, ok := profiles[profileId]; ok {
+			review["profile"] = profile
+		} else {
+			review["profile"] = bson.M{}
+		}
+	}
+	return nil
 }
 
 func GetReview(reviewId string, review *models.Review) error {
@@ -178,89 +315,160 @@ func GetReview(reviewId string, review *models.Review) error {
 	return err
 }
 
-func GetAllReviewCount(bookId string) (int64, error) {
-	itemCount, err := db.DatabaseObj.Collection("review").CountDocuments(context.Background(), bson.M{"book": bookId})
+// Insert one task in the DB
+// Only buyers whose order of the book was delivered can review it, once per
+// order.
+func insertReview(review *models.Review) error {
+	if !validStars(review.Stars) {
+		return errors.New(ErrorInvalidStars)
+	}
+	var book models.Book
+	if err := GetBook(review.Book, &book); err != nil {
+		return errors.New(ErrorBookNotFound)
+	}
 
+	orderId, err := claimDeliveredOrder(review.Profile, review.Book)
 	if err != nil {
-		return 0, errors.New(ErrorFailedToFetchRecord)
+		return err
 	}
-	fmt.Println(itemCount, reflect.TypeOf(itemCount))
-
-	//GetStarReviewCount(bookId)
-
-	return itemCount, nil
-}
-
-func GetStarReviewCount(bookId string) (map[string]int64, error) {
-	fiveStar, err1 := db.DatabaseObj.Collection("review").CountDocuments(context.Background(), bson.M{"stars": 5, "book": bookId})
-	fourStar, err2 := db.DatabaseObj.Collection("review").CountDocuments(context.Background(), bson.M{"stars": 4, "book": bookId})
-	threeStar, err3 := db.DatabaseObj.Collection("review").CountDocuments(context.Background(), bson.M{"stars": 3, "book": bookId})
-	twoStar, err4 := db.DatabaseObj.Collection("review").CountDocuments(context.Background(), bson.M{"stars": 2, "book": bookId})
-	oneStar, err5 := db.DatabaseObj.Collection("review").CountDocuments(context.Background(), bson.M{"stars": 1, "book": bookId})
 
-	fmt.Println(fiveStar, fourStar, threeStar, twoStar, oneStar)
-	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil {
-		return nil, errors.New(ErrorFailedToFetchRecord)
+	review.Order = orderId
+	review.Verified = true
+	review.ImageVariants = storage.VariantsFor(review.Images)
+	review.HelpfulCount = 0
+	review.UnhelpfulCount = 0
+	review.ReportCount = 0
+	review.ModeratedBy = ""
+	review.ModeratedAt = time.Time{}
+	review.FlaggedReason = FlagContent(review.Content)
+	review.Status = ReviewStatusPublished
+	if review.FlaggedReason != "" {
+		review.Status = ReviewStatusPending
 	}
-	return map[string]int64{"fiveStar": fiveStar, "fourStar": fourStar, "threeStar": threeStar, "twoStar": twoStar, "oneStar": oneStar}, nil
-}
-
-// Insert one task in the DB
-func insertReview(review models.Review) error {
 	review.CreatedAt = time.Now()
 	review.UpdatedAt = time.Now()
 	insertResult, err := db.DatabaseObj.Collection("review").InsertOne(context.Background(), review)
 
 	if err != nil {
+		setOrderReviewed(orderId, false)
 		return errors.New(ErrorCouldNotUpdateItem)
 	}
 
+	review.ID = insertResult.InsertedID.(primitive.ObjectID)
 	fmt.Println("Inserted a Single Record ", insertResult.InsertedID)
+	if review.Status == ReviewStatusPublished {
+		AdjustBookRating(review.Book, 0, review.Stars)
+		NotifyNewReview(*review)
+	}
 	return nil
 
 }
 
-func UpdateBookAfterReview(bookId string, review models.Review, updateType string) error {
-	fmt.Println(bookId)
-	id, _ := primitive.ObjectIDFromHex(bookId)
-	var book models.Book
-
-	// GET BOOK BY ID
-	ctx, _ := context.WithTimeout(context.Background(), 30*time.Second)
-	err := db.DatabaseObj.Collection("book").FindOne(ctx, bson.M{"_id": id}).Decode(&book)
-
-	bookReviewCount := book.ReviewCount
-	bookReviewAvg := book.AverageRating * float64(bookReviewCount)
-	if updateType == "INSERT" {
-		bookReviewCount += 1
+// claimDeliveredOrder marks one delivered, not yet reviewed order of the book
+// by this buyer as reviewed and returns its id. Doing it in a single update
+// stops two concurrent reviews from using the same order.
+func claimDeliveredOrder(profileId string, bookId string) (string, error) {
+	var order models.Order
+	err := db.DatabaseObj.Collection("order").FindOneAndUpdate(context.Background(),
+		bson.M{
+			"buyer":    profileId,
+			"book":     bookId,
+			"status":   OrderStatusDelivered,
+			"reviewed": bson.M{"$ne": true},
+		},
+		bson.M{"$set": bson.M{"reviewed": true, "updated_at": time.Now()}},
+	).Decode(&order)
+	if err != nil {
+		return "", errors.New(ErrorNotVerifiedPurchase)
 	}
-	newBookRating := (bookReviewAvg + float64(review.Stars)) / float64(bookReviewCount)
-	filter := bson.M{"_id": id}
-	update := bson.M{"$set": bson.M{
-		"reviewcount":   bookReviewCount,
-		"averagerating": newBookRating,
-	}}
-	result, err := db.DatabaseObj.Collection("book").UpdateOne(context.Background(), filter, update)
+	return order.ID.Hex(), nil
+}
+
+func setOrderReviewed(orderId string, reviewed bool) {
+	id, _ := primitive.ObjectIDFromHex(orderId)
+	_, err := db.DatabaseObj.Collection("order").UpdateOne(context.Background(), bson.M{"_id": id},
+		bson.M{"$set": bson.M{"reviewed": reviewed, "updated_at": time.Now()}})
 	if err != nil {
-		log.Fatal(err)
+		fmt.Println(err, "COULD NOT UPDATE ORDER REVIEWED FLAG")
 	}
+}
 
-	fmt.Println("modified count: ", result.ModifiedCount)
-	return err
+// NotifyNewReview lets the seller know their book was reviewed.
+func NotifyNewReview(review models.Review) {
+	var book models.Book
+	if GetBook(review.Book, &book) != nil {
+		return
+	}
+	var seller, reviewer models.Profile
+	if GetProfile(book.Profile, &seller) != nil {
+		return
+	}
+	GetProfile(review.Profile, &reviewer)
+	notifications.Email(notifications.NewReview, seller.Email, notifications.ReviewEmail{
+		Name:      seller.Username,
+		BookTitle: book.Title,
+		Reviewer:  reviewer.Username,
+		Stars:     review.Stars,
+		Content:   review.Content,
+	})
+	notifications.Store(book.Profile, notifications.NewReview, map[string]interface{}{
+		"book":     review.Book,
+		"title":    book.Title,
+		"reviewer": reviewer.Username,
+		"stars":    review.Stars,
+	})
 }
 
 // task complete method, update task's status to true
 func updateReview(reviewId string, review models.Review) error {
 	fmt.Println(reviewId)
+	if !validStars(review.Stars) {
+		return errors.New(ErrorInvalidStars)
+	}
 	id, _ := primitive.ObjectIDFromHex(reviewId)
 	filter := bson.M{"_id": id}
-	update := bson.M{"$set": bson.M{"stars": review.Stars, "content": review.Content}}
-	result, err := db.DatabaseObj.Collection("review").UpdateOne(context.Background(), filter, update)
+	// edited text goes through the filter again. An edit can't undo a
+	// moderator's decision or a hold put on by buyer reports though, and a
+	// hidden review stays hidden whatever the new text is.
+	hidden := bson.M{"$eq": bson.A{"$status", ReviewStatusHidden}}
+	heldByModeration := bson.M{"$or": bson.A{
+		hidden,
+		bson.M{"$and": bson.A{
+			bson.M{"$eq": bson.A{"$status", ReviewStatusPending}},
+			bson.M{"$gte": bson.A{"$report_count", ReportThreshold}},
+		}},
+	}}
+	reason := FlagContent(review.Content)
+	keep, newStatus := heldByModeration, ReviewStatusPublished
+	if reason != "" {
+		keep, newStatus = hidden, ReviewStatusPending
+	}
+	// this is a pipeline update, so anything the user typed is wrapped in
+	// $literal to stop "$field" or "$$ROOT" being read as an expression
+	update := bson.A{bson.M{"$set": bson.M{
+		"stars":          bson.M{"$literal": review.Stars},
+		"content":        bson.M{"$literal": review.Content},
+		"status":         bson.M{"$cond": bson.A{keep, "$status", newStatus}},
+		"flagged_reason": bson.M{"$cond": bson.A{keep, "$flagged_reason", bson.M{"$literal": reason}}},
+		"updated_at":     time.Now(),
+	}}}
+	// the previous stars and status tell us how to move the book's counters
+	var previous models.Review
+	err := db.DatabaseObj.Collection("review").FindOneAndUpdate(context.Background(), filter, update).Decode(&previous)
 	if err != nil {
 		return errors.New(ErrorCouldNotUpdateItem)
 	}
 
-	fmt.Println("modified count: ", result.ModifiedCount)
+	var removed, added int32
+	if isPublished(previous.Status) {
+		removed = previous.Stars
+	}
+	held := previous.Status == ReviewStatusHidden ||
+		previous.Status == ReviewStatusPending && previous.ReportCount >= ReportThreshold
+	if reason == "" && !held {
+		added = review.Stars
+	}
+	AdjustBookRating(previous.Book, removed, added)
 	return nil
 }
 
@@ -269,12 +477,32 @@ func deleteReview(reviewId string) error {
 	fmt.Println(reviewId)
 	id, _ := primitive.ObjectIDFromHex(reviewId)
 	filter := bson.M{"_id": id}
-	d, err := db.DatabaseObj.Collection("review").DeleteOne(context.Background(), filter)
-	if err != nil {
+	var review models.Review
+	if err := db.DatabaseObj.Collection("review").FindOneAndDelete(context.Background(), filter).Decode(&review); err != nil {
 		return errors.New(ErrorCouldNotDeleteItem)
 	}
 
-	fmt.Println("Deleted Document", d.DeletedCount)
+	if isPublished(review.Status) {
+		AdjustBookRating(review.Book, review.Stars, 0)
+	}
+	deleteVotes(reviewId)
+	deleteReports(reviewId)
+	// the buyer may review the order again
+	if review.Order != "" {
+		setOrderReviewed(review.Order, false)
+	}
+	fmt.Println("Deleted Document", review.ID)
+	return nil
+}
+
+func GetBook(bookId string, book *models.Book) error {
+	id, _ := primitive.ObjectIDFromHex(bookId)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := db.DatabaseObj.Collection("book").FindOne(ctx, bson.M{"_id": id}).Decode(book)
+	if err != nil {
+		return errors.New(ErrorFailedToFetchRecord)
+	}
 	return nil
 }
 
@@ -17,15 +17,43 @@ func MatchRouteReview(req events.APIGatewayProxyRequest) (*events.APIGatewayProx
 			return GetAllReviewsHandler(req)
 		} else if req.Resource == "/review/{reviewId}" {
 			return GetReviewHandler(req)
+		} else if req.Resource == "/review/stats/{bookId}" {
+			return GetReviewStatsHandler(req)
+		} else if req.Resource == "/review/moderation" {
+			return GetModerationQueueHandler(req)
 		} else {
 			return helpers.UnhandledMethod()
 		}
 	case "POST":
-		return CreateReviewHandler(req)
+		if req.Resource == "/review/{reviewId}/vote" {
+			return VoteReviewHandler(req)
+		} else if req.Resource == "/review/{reviewId}/report" {
+			return ReportReviewHandler(req)
+		} else if req.Resource == "/review/{reviewId}/reply" {
+			return CreateReplyHandler(req)
+		} else if req.Resource == "/review" {
+			return CreateReviewHandler(req)
+		} else {
+			return helpers.UnhandledMethod()
+		}
 	case "PUT":
-		return UpdateReviewHandler(req)
+		if req.Resource == "/review/{reviewId}/moderate" {
+			return ModerateReviewHandler(req)
+		} else if req.Resource == "/review/{reviewId}/reply" {
+			return UpdateReplyHandler(req)
+		} else if req.Resource == "/review/{reviewId}" {
+			return UpdateReviewHandler(req)
+		} else {
+			return helpers.UnhandledMethod()
+		}
 	case "DELETE":
-		return DeleteReviewHandler(req)
+		if req.Resource == "/review/{reviewId}/reply" {
+			return DeleteReplyHandler(req)
+		} else if req.Resource == "/review/{reviewId}" {
+			return DeleteReviewHandler(req)
+		} else {
+			return helpers.UnhandledMethod()
+		}
 	default:
 		fmt.Println("Exiting handler")
 		return helpers.UnhandledMethod()
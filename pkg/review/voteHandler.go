@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"the-book-store/db"
+	"the-book-store/helpers"
+	"the-book-store/models"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrorMissingProfile = "missing X-Profile-Id header"
+	ErrorReviewNotFound = "review not found"
+	ErrorOwnReviewVote  = "you cannot vote on your own review"
+)
+
+// POST review/{reviewId}/vote
+func VoteReviewHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := helpers.CallerProfileId(req)
+	if profileId == "" {
+		return helpers.ApiResponse(http.StatusUnauthorized, ErrorBody{
+			aws.String(ErrorMissingProfile),
+		})
+	}
+	var vote models.ReviewVote
+	if err := json.Unmarshal([]byte(req.Body), &vote); err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	vote.Profile = profileId
+	vote.Review = req.PathParameters["reviewId"]
+	review, err := VoteReview(vote)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, review)
+}
+
+// VoteReview records a profile's vote and moves the review's counters. A
+// profile has one vote per review; voting again with the other choice
+// switches it, voting again with the same choice changes nothing.
+func VoteReview(vote models.ReviewVote) (models.Review, error) {
+	var review models.Review
+	if err := GetReview(vote.Review, &review); err != nil {
+		return review, errors.New(ErrorReviewNotFound)
+	}
+	if review.Profile == vote.Profile {
+		return review, errors.New(ErrorOwnReviewVote)
+	}
+
+	previous, err := castVote(vote)
+	// two upserts at once both insert, the unique (review, profile) index
+	// turns one away and trying again finds the vote the other one made
+	if mongo.IsDuplicateKeyError(err) {
+		previous, err = castVote(vote)
+	}
+
+	inc := bson.M{}
+	switch {
+	case err == mongo.ErrNoDocuments:
+		inc[voteField(vote.Helpful)] = 1
+	case err != nil:
+		return review, errors.New(ErrorCouldNotUpdateItem)
+	case previous.Helpful != vote.Helpful:
+		inc[voteField(vote.Helpful)] = 1
+		inc[voteField(previous.Helpful)] = -1
+	default:
+		return review, nil
+	}
+
+	id, _ := primitive.ObjectIDFromHex(vote.Review)
+	err = db.DatabaseObj.Collection("review").FindOneAndUpdate(context.Background(), bson.M{"_id": id},
+		bson.M{"$inc": inc},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&review)
+	if err != nil {
+		fmt.Println(err, "COULD NOT UPDATE REVIEW VOTES")
+		return review, errors.New(ErrorCouldNotUpdateItem)
+	}
+	return review, nil
+}
+
+// castVote stores a vote and returns the one it replaced,
+// mongo.ErrNoDocuments for a first vote.
+func castVote(vote models.ReviewVote) (models.ReviewVote, error) {
+	var previous models.ReviewVote
+	err := db.DatabaseObj.Collection("review_vote").FindOneAndUpdate(context.Background(),
+		bson.M{"review": vote.Review, "profile": vote.Profile},
+		bson.M{
+			"$set":         bson.M{"helpful": vote.Helpful, "updated_at": time.Now()},
+			"$setOnInsert": bson.M{"created_at": time.Now()},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+	).Decode(&previous)
+	return previous, err
+}
+
+func voteField(helpful bool) string {
+	if helpful {
+		return "helpful_count"
+	}
+	return "unhelpful_count"
+}
+
+// deleteVotes drops the votes cast on a deleted review.
+func deleteVotes(reviewId string) {
+	_, err := db.DatabaseObj.Collection("review_vote").DeleteMany(context.Background(), bson.M{"review": reviewId})
+	if err != nil {
+		fmt.Println(err, "COULD NOT DELETE REVIEW VOTES")
+	}
+}
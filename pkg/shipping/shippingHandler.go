@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"the-book-store/db"
+	"the-book-store/dtos"
+	"the-book-store/helpers"
+	"the-book-store/models"
+	"the-book-store/shipping"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrorFailedToFetchRecord = "failed to fetch record"
+	ErrorInvalidData         = "invalid data"
+)
+
+type ErrorBody struct {
+	ErrorMsg *string `json:"error,omitempty"`
+}
+
+// GET shipping/quote?bookIds=a,b&quantities=1,2&pincode=560001
+func GetShippingQuoteHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	pincode := req.QueryStringParameters["pincode"]
+	bookIds := strings.Split(req.QueryStringParameters["bookIds"], ",")
+	quantities := strings.Split(req.QueryStringParameters["quantities"], ",")
+
+	var items []dtos.QuoteItem
+	for index, bookId := range bookIds {
+		if bookId == "" {
+			continue
+		}
+		quantity := int64(1)
+		if index < len(quantities) && quantities[index] != "" {
+			parsed, err := strconv.ParseInt(quantities[index], 10, 64)
+			if err != nil || parsed < 1 {
+				return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+					aws.String(ErrorInvalidData),
+				})
+			}
+			quantity = parsed
+		}
+		items = append(items, dtos.QuoteItem{Book: bookId, Quantity: quantity})
+	}
+	if len(items) == 0 {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(ErrorInvalidData),
+		})
+	}
+
+	payload, err := GetShippingQuote(items, pincode)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, payload)
+}
+
+func GetShippingQuote(items []dtos.QuoteItem, pincode string) (dtos.ShippingQuote, error) {
+	var shippingItems []shipping.Item
+	sellerPincodes := map[string]string{}
+	for _, item := range items {
+		var book models.Book
+		if err := GetBook(item.Book, &book); err != nil {
+			return dtos.ShippingQuote{}, err
+		}
+		if _, ok := sellerPincodes[book.Profile]; !ok {
+			var seller models.Profile
+			GetProfile(book.Profile, &seller)
+			sellerPincodes[book.Profile] = seller.Pincode
+		}
+		shippingItems = append(shippingItems, shipping.Item{
+			Book:        item.Book,
+			Seller:      book.Profile,
+			FromPincode: sellerPincodes[book.Profile],
+			Weight:      shipping.ItemWeight(book.Weight, item.Quantity),
+		})
+	}
+
+	shipments, total, err := shipping.QuoteShipments(shippingItems, pincode)
+	if err != nil {
+		return dtos.ShippingQuote{}, err
+	}
+	return dtos.ShippingQuote{Pincode: pincode, Shipments: shipments, Total: total}, nil
+}
+
+func GetBook(bookId string, book *models.Book) error {
+	id, _ := primitive.ObjectIDFromHex(bookId)
+	fmt.Println("Object id", id, bookId)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := db.DatabaseObj.Collection("book").FindOne(ctx, bson.M{"_id": id}).Decode(book)
+	if err != nil {
+		return errors.New(ErrorFailedToFetchRecord)
+	}
+	return nil
+}
+
+func GetProfile(profileId string, profile *models.Profile) error {
+	id, _ := primitive.ObjectIDFromHex(profileId)
+	fmt.Println("Object id", id, profileId)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := db.DatabaseObj.Collection("profile").FindOne(ctx, bson.M{"_id": id}).Decode(profile)
+	if err != nil {
+		return errors.New(ErrorFailedToFetchRecord)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"the-book-store/helpers"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func MatchRouteShipping(req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	fmt.Println("hello I`m inside the SHIPPING handler")
+	fmt.Printf("%+v\n", req)
+	switch req.HTTPMethod {
+	case "GET":
+		if req.Resource == "/shipping/quote" {
+			return GetShippingQuoteHandler(req)
+		} else {
+			return helpers.UnhandledMethod()
+		}
+	default:
+		fmt.Println("Exiting handler")
+		return helpers.UnhandledMethod()
+	}
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"the-book-store/db"
+	"the-book-store/dtos"
+	"the-book-store/helpers"
+	"the-book-store/models"
+	"the-book-store/storage"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	PurposeBookImage    = "BOOK_IMAGE"
+	PurposeReviewImage  = "REVIEW_IMAGE"
+	PurposeProfileImage = "PROFILE_IMAGE"
+)
+
+const (
+	UploadStatusPending    = "PENDING"
+	UploadStatusProcessing = "PROCESSING"
+	UploadStatusCompleted  = "COMPLETED"
+	UploadStatusFailed     = "FAILED"
+)
+
+// how long a pre-signed link stays usable
+const uploadExpiry = 15 * time.Minute
+
+// how often attaching an image is retried when the images change meanwhile
+const attachAttempts = 3
+
+// folder each purpose stores its files in
+var uploadFolders = map[string]string{
+	PurposeBookImage:    "book",
+	PurposeReviewImage:  "review",
+	PurposeProfileImage: "profile",
+}
+
+var allowedContentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+var (
+	ErrorFailedToFetchRecord  = "failed to fetch record"
+	ErrorCouldNotUpdateItem   = "could not update item"
+	ErrorMissingProfile       = "missing X-Profile-Id header"
+	ErrorInvalidPurpose       = "purpose must be BOOK_IMAGE, REVIEW_IMAGE or PROFILE_IMAGE"
+	ErrorInvalidContentType   = "content_type must be image/jpeg, image/png or image/gif"
+	ErrorInvalidSize          = "size must be the file's length in bytes and within the image size limit"
+	ErrorTargetNotFound       = "upload target not found"
+	ErrorNotTargetOwner       = "you can only upload images for your own books, reviews and profile"
+	ErrorUploadNotFound       = "upload not found"
+	ErrorUploadNotPending     = "upload was already completed, has failed or is being completed"
+	ErrorUploadExpired        = "upload link has expired, request a new one"
+	ErrorUploadMissing        = "no file was uploaded"
+	ErrorContentTypeMismatch  = "uploaded file doesn't match the requested content type"
+	ErrorCouldNotCreateLink   = "could not create upload link"
+	ErrorLocalUploadsDisabled = "local uploads are only available with the local store"
+	ErrorImagesChanged        = "the images were changed meanwhile, complete the upload again"
+)
+
+type ErrorBody struct {
+	ErrorMsg *string `json:"error,omitempty"`
+}
+
+// POST upload/request
+func RequestUploadHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := helpers.CallerProfileId(req)
+	if profileId == "" {
+		return helpers.ApiResponse(http.StatusUnauthorized, ErrorBody{
+			aws.String(ErrorMissingProfile),
+		})
+	}
+	var request dtos.UploadRequest
+	if err := json.Unmarshal([]byte(req.Body), &request); err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	ticket, err := RequestUpload(profileId, request)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusCreated, ticket)
+}
+
+// POST upload/{uploadId}/complete
+func CompleteUploadHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	profileId := helpers.CallerProfileId(req)
+	if profileId == "" {
+		return helpers.ApiResponse(http.StatusUnauthorized, ErrorBody{
+			aws.String(ErrorMissingProfile),
+		})
+	}
+	image, err := CompleteUpload(req.PathParameters["uploadId"], profileId)
+	if err != nil {
+		return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, image)
+}
+
+// PUT upload/local/{key+}
+// Receives the file for a link signed by the local store. With S3 the client
+// PUTs to the bucket and this route isn't used.
+func LocalPutHandler(req events.APIGatewayProxyRequest) (
+	*events.APIGatewayProxyResponse,
+	error,
+) {
+
+	store, ok := storage.DefaultStore().(storage.LocalStore)
+	if !ok {
+		return helpers.ApiResponse(http.StatusNotFound, ErrorBody{
+			aws.String(ErrorLocalUploadsDisabled),
+		})
+	}
+	body := []byte(req.Body)
+	if req.IsBase64Encoded {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(req.Body); err != nil {
+			return helpers.ApiResponse(http.StatusBadRequest, ErrorBody{
+				aws.String(err.Error()),
+			})
+		}
+	}
+	key := req.PathParameters["key"]
+	contentType := helpers.Header(req, "Content-Type")
+	err := storage.VerifyLocalPut(key, contentType, body, req.QueryStringParameters["size"],
+		req.QueryStringParameters["expires"], req.QueryStringParameters["signature"])
+	if err != nil {
+		return helpers.ApiResponse(http.StatusForbidden, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	if _, err := store.Put(key, contentType, body); err != nil {
+		return helpers.ApiResponse(http.StatusInternalServerError, ErrorBody{
+			aws.String(err.Error()),
+		})
+	}
+	return helpers.ApiResponse(http.StatusOK, key)
+}
+
+// RequestUpload checks the caller owns the target and hands out a link to
+// upload the file straight to the store.
+func RequestUpload(profileId string, request dtos.UploadRequest) (dtos.UploadTicket, error) {
+	var ticket dtos.UploadTicket
+	folder, ok := uploadFolders[request.Purpose]
+	if !ok {
+		return ticket, errors.New(ErrorInvalidPurpose)
+	}
+	if !allowedContentTypes[request.ContentType] {
+		return ticket, errors.New(ErrorInvalidContentType)
+	}
+	if request.Size <= 0 || request.Size > storage.MaxImageSize {
+		return ticket, errors.New(ErrorInvalidSize)
+	}
+	if err := checkTarget(profileId, request.Purpose, request.Target); err != nil {
+		return ticket, err
+	}
+
+	key := storage.ImageKey(folder, request.Target, request.ContentType)
+	signed, err := storage.DefaultStore().PresignPut(key, request.ContentType, request.Size, uploadExpiry)
+	if err != nil {
+		fmt.Println(err, "COULD NOT PRESIGN UPLOAD", key)
+		return ticket, errors.New(ErrorCouldNotCreateLink)
+	}
+
+	upload := models.Upload{
+		Profile:     profileId,
+		Purpose:     request.Purpose,
+		Target:      request.Target,
+		Key:         key,
+		ContentType: request.ContentType,
+		Size:        request.Size,
+		Status:      UploadStatusPending,
+		ExpiresAt:   time.Now().Add(uploadExpiry),
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	insertResult, err := db.DatabaseObj.Collection("upload").InsertOne(context.Background(), upload)
+	if err != nil {
+		return ticket, errors.New(ErrorCouldNotUpdateItem)
+	}
+
+	return dtos.UploadTicket{
+		UploadId:  insertResult.InsertedID.(primitive.ObjectID).Hex(),
+		URL:       signed.URL,
+		Method:    http.MethodPut,
+		Headers:   signed.Headers,
+		ExpiresAt: upload.ExpiresAt,
+	}, nil
+}
+
+// checkTarget makes sure the book or review belongs to the caller, or that
+// the profile is the caller's own.
+func checkTarget(profileId string, purpose string, target string) error {
+	id, err := primitive.ObjectIDFromHex(target)
+	if err != nil {
+		return errors.New(ErrorTargetNotFound)
+	}
+	collection := map[string]string{
+		PurposeBookImage:    "book",
+		PurposeReviewImage:  "review",
+		PurposeProfileImage: "profile",
+	}[purpose]
+	var owner struct {
+		ID      primitive.ObjectID `bson:"_id"`
+		Profile string             `bson:"profile"`
+	}
+	err = db.DatabaseObj.Collection(collection).FindOne(context.Background(), bson.M{"_id": id}).Decode(&owner)
+	if err != nil {
+		return errors.New(ErrorTargetNotFound)
+	}
+	// a profile is its own owner
+	if purpose == PurposeProfileImage {
+		owner.Profile = owner.ID.Hex()
+	}
+	if owner.Profile != profileId {
+		return errors.New(ErrorNotTargetOwner)
+	}
+	return nil
+}
+
+// CompleteUpload checks the file the client uploaded really is an image of
+// the announced type, makes its variants and attaches it to the book, review
+// or profile. A bad file is deleted and the upload marked failed.
+func CompleteUpload(uploadId string, profileId string) (models.Image, error) {
+	upload, err := claimUpload(uploadId, profileId)
+	if err != nil {
+		return models.Image{}, err
+	}
+
+	store := storage.DefaultStore()
+	body, _, err := store.Get(upload.Key)
+	if err == storage.ErrorBlobNotFound {
+		// the link may still be used until it expires
+		if time.Now().After(upload.ExpiresAt) {
+			setUploadStatus(upload, UploadStatusFailed, "")
+			return models.Image{}, errors.New(ErrorUploadExpired)
+		}
+		setUploadStatus(upload, UploadStatusPending, "")
+		return models.Image{}, errors.New(ErrorUploadMissing)
+	}
+	if err != nil {
+		fmt.Println(err, "COULD NOT READ UPLOAD", upload.Key)
+		setUploadStatus(upload, UploadStatusPending, "")
+		return models.Image{}, errors.New(ErrorFailedToFetchRecord)
+	}
+
+	contentType, err := storage.SniffImage(body)
+	if err == nil && contentType != upload.ContentType {
+		err = errors.New(ErrorContentTypeMismatch)
+	}
+	if err != nil {
+		store.Delete(upload.Key)
+		setUploadStatus(upload, UploadStatusFailed, "")
+		return models.Image{}, err
+	}
+
+	image, err := storage.RecordImage(store, upload.Key, profileId, contentType, body)
+	if err != nil {
+		fmt.Println(err, "COULD NOT RECORD UPLOAD", upload.Key)
+		store.Delete(upload.Key)
+		setUploadStatus(upload, UploadStatusFailed, "")
+		return image, errors.New(ErrorCouldNotUpdateItem)
+	}
+	if err := attachImage(upload, image); err != nil {
+		// the files stay under the upload's key, completing again records
+		// them anew, so the record goes or the retry would make a second one
+		if err := storage.ForgetImage(upload.Key); err != nil {
+			fmt.Println(err, "COULD NOT FORGET IMAGE", upload.Key)
+		}
+		setUploadStatus(upload, UploadStatusPending, "")
+		return image, err
+	}
+	setUploadStatus(upload, UploadStatusCompleted, image.URL)
+	return image, nil
+}
+
+// claimUpload moves a pending upload of the caller to PROCESSING in one
+// step, so two calls to complete it can't both attach the image.
+func claimUpload(uploadId string, profileId string) (models.Upload, error) {
+	var upload models.Upload
+	id, _ := primitive.ObjectIDFromHex(uploadId)
+	uploads := db.DatabaseObj.Collection("upload")
+	err := uploads.FindOneAndUpdate(context.Background(), bson.M{
+		"_id":     id,
+		"profile": profileId,
+		"status":  UploadStatusPending,
+	}, bson.M{"$set": bson.M{"status": UploadStatusProcessing, "updated_at": time.Now()}}).Decode(&upload)
+	if err == nil {
+		return upload, nil
+	}
+	if err := uploads.FindOne(context.Background(), bson.M{"_id": id}).Decode(&upload); err != nil || upload.Profile != profileId {
+		return upload, errors.New(ErrorUploadNotFound)
+	}
+	return upload, errors.New(ErrorUploadNotPending)
+}
+
+// attachImage adds the image to the end of a book's or review's images, a
+// book without a cover getting it as its cover, or replaces a profile image.
+func attachImage(upload models.Upload, image models.Image) error {
+	id, _ := primitive.ObjectIDFromHex(upload.Target)
+	var err error
+	switch upload.Purpose {
+	case PurposeBookImage:
+		err = appendImage("book", id, image.URL)
+	case PurposeReviewImage:
+		err = appendImage("review", id, image.URL)
+	case PurposeProfileImage:
+		_, err = db.DatabaseObj.Collection("profile").UpdateOne(context.Background(), bson.M{"_id": id}, bson.M{
+			"$set": bson.M{
+				"profile_image":          image.URL,
+				"profile_image_variants": image.Variants,
+				"updated_at":             time.Now(),
+			},
+		})
+	}
+	if err != nil {
+		fmt.Println(err, "COULD NOT ATTACH UPLOAD", upload.ID.Hex())
+		if err.Error() == ErrorImagesChanged {
+			return err
+		}
+		return errors.New(ErrorCouldNotUpdateItem)
+	}
+	return nil
+}
+
+// appendImage adds an image to a book's or review's images the way the book
+// image endpoints save them: the variants are rebuilt for the whole list,
+// which also mends lists older documents have out of step, and the update
+// only applies if the images are still the ones read. A book without a cover
+// gets the image as its cover.
+func appendImage(collection string, id primitive.ObjectID, url string) error {
+	for attempt := 0; attempt < attachAttempts; attempt++ {
+		var current struct {
+			Images     []string `bson:"images"`
+			CoverImage string   `bson:"coverimage"`
+		}
+		err := db.DatabaseObj.Collection(collection).FindOne(context.Background(), bson.M{"_id": id}).Decode(&current)
+		if err != nil {
+			return err
+		}
+		if indexOf(current.Images, url) >= 0 {
+			return nil
+		}
+
+		images := append(append([]string{}, current.Images...), url)
+		filter := bson.M{"_id": id, "images": current.Images}
+		if len(current.Images) == 0 {
+			filter["images"] = bson.M{"$in": bson.A{nil, bson.A{}}}
+		}
+		set := bson.M{
+			"images":         images,
+			"image_variants": storage.VariantsFor(images),
+			"updated_at":     time.Now(),
+		}
+		if collection == "book" && current.CoverImage == "" {
+			filter["coverimage"] = bson.M{"$in": bson.A{nil, ""}}
+			set["coverimage"] = url
+			set["cover_variants"] = storage.VariantsOf(url)
+		}
+		result, err := db.DatabaseObj.Collection(collection).UpdateOne(context.Background(), filter, bson.M{"$set": set})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount > 0 {
+			return nil
+		}
+	}
+	return errors.New(ErrorImagesChanged)
+}
+
+func indexOf(list []string, value string) int {
+	for i, item := range list {
+		if item == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func setUploadStatus(upload models.Upload, status string, url string) {
+	set := bson.M{"status": status, "updated_at": time.Now()}
+	if status == UploadStatusCompleted {
+		set["url"] = url
+		set["completed_at"] = time.Now()
+	}
+	_, err := db.DatabaseObj.Collection("upload").UpdateOne(context.Background(), bson.M{"_id": upload.ID}, bson.M{"$set": set})
+	if err != nil {
+		fmt.Println(err, "COULD NOT UPDATE UPLOAD STATUS", upload.ID.Hex())
+	}
+}
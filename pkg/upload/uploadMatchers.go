@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"the-book-store/helpers"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func MatchRouteUpload(req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	fmt.Println("hello I`m inside the UPLOAD handler")
+	fmt.Printf("%+v\n", req.Resource)
+	switch req.HTTPMethod {
+	case "POST":
+		if req.Resource == "/upload/request" {
+			return RequestUploadHandler(req)
+		} else if req.Resource == "/upload/{uploadId}/complete" {
+			return CompleteUploadHandler(req)
+		} else {
+			return helpers.UnhandledMethod()
+		}
+	case "PUT":
+		if req.Resource == "/upload/local/{key+}" {
+			return LocalPutHandler(req)
+		} else {
+			return helpers.UnhandledMethod()
+		}
+	default:
+		fmt.Println("Exiting handler")
+		return helpers.UnhandledMethod()
+	}
+}
@@ -0,0 +1,66 @@
+package shipping
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultHandlingDays applies to sellers who have not said how long they
+// take to pack and dispatch an order.
+const DefaultHandlingDays = 1
+
+// Holidays lists the dates (YYYY-MM-DD) couriers do not move parcels on, in
+// addition to Sundays. The fixed national holidays are always observed;
+// HOLIDAYS can add more as a comma separated list.
+var Holidays = map[string]bool{}
+
+var nationalHolidays = []string{"01-26", "08-15", "10-02", "12-25"}
+
+func init() {
+	for _, date := range strings.Split(os.Getenv("HOLIDAYS"), ",") {
+		if date = strings.TrimSpace(date); date != "" {
+			Holidays[date] = true
+		}
+	}
+}
+
+// IsHoliday reports whether no deliveries happen on the given day.
+func IsHoliday(day time.Time) bool {
+	if day.Weekday() == time.Sunday {
+		return true
+	}
+	for _, holiday := range nationalHolidays {
+		if day.Format("01-02") == holiday {
+			return true
+		}
+	}
+	return Holidays[day.Format("2006-01-02")]
+}
+
+// AddWorkingDays moves forward the given number of working days, skipping
+// Sundays and holidays.
+func AddWorkingDays(from time.Time, days int64) time.Time {
+	day := from
+	for days > 0 {
+		day = day.AddDate(0, 0, 1)
+		if !IsHoliday(day) {
+			days--
+		}
+	}
+	return day
+}
+
+// EstimateDelivery works out when a parcel should arrive: the seller first
+// needs handlingDays to dispatch it, then it spends the book's advertised
+// delivery time or the zone's transit time in transit, whichever is longer.
+func EstimateDelivery(from time.Time, handlingDays int64, deliveryDays int64, zone string) time.Time {
+	if handlingDays <= 0 {
+		handlingDays = DefaultHandlingDays
+	}
+	transitDays := Rates[zone].TransitDays
+	if deliveryDays > transitDays {
+		transitDays = deliveryDays
+	}
+	return AddWorkingDays(from, handlingDays+transitDays)
+}
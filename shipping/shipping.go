@@ -0,0 +1,170 @@
+package shipping
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+const (
+	ZoneLocal    = "LOCAL"
+	ZoneRegional = "REGIONAL"
+	ZoneNational = "NATIONAL"
+	ZoneSpecial  = "SPECIAL"
+)
+
+// DefaultItemWeight is used for books listed without a weight, in grams.
+const DefaultItemWeight = 500
+
+var ErrorInvalidPincode = "invalid pincode"
+
+// Rate is the tariff of a zone: Base covers the first slab, every further
+// slab (or part of it) costs PerSlab. TransitDays is how many working days
+// couriers usually take within the zone.
+type Rate struct {
+	Base        float64 `json:"base"`
+	PerSlab     float64 `json:"per_slab"`
+	SlabGrams   float64 `json:"slab_grams"`
+	TransitDays int64   `json:"transit_days"`
+}
+
+// Rates is the zone rate table. It can be replaced at deploy time by setting
+// SHIPPING_RATES to a JSON object keyed by zone.
+var Rates = map[string]Rate{
+	ZoneLocal:    {Base: 40, PerSlab: 20, SlabGrams: 500, TransitDays: 1},
+	ZoneRegional: {Base: 60, PerSlab: 30, SlabGrams: 500, TransitDays: 3},
+	ZoneNational: {Base: 80, PerSlab: 40, SlabGrams: 500, TransitDays: 5},
+	ZoneSpecial:  {Base: 120, PerSlab: 60, SlabGrams: 500, TransitDays: 8},
+}
+
+// SpecialPrefixes are destination pincode prefixes served at the special zone
+// rate (Jammu & Kashmir, the North East and the Andaman & Nicobar islands).
+var SpecialPrefixes = []string{"18", "19", "78", "79", "744"}
+
+type Quote struct {
+	Zone   string  `json:"zone"`
+	Weight float64 `json:"weight"`
+	Charge float64 `json:"charge"`
+}
+
+func init() {
+	if raw := os.Getenv("SHIPPING_RATES"); raw != "" {
+		var rates map[string]Rate
+		if err := json.Unmarshal([]byte(raw), &rates); err != nil {
+			fmt.Println(err, "INVALID SHIPPING_RATES, USING DEFAULTS")
+			return
+		}
+		for zone, rate := range rates {
+			Rates[zone] = rate
+		}
+	}
+}
+
+// ValidPincode reports whether s looks like an Indian postal code.
+func ValidPincode(s string) bool {
+	if len(s) != 6 || s[0] == '0' {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Zone classifies a shipment by how far apart the two pincodes are. An
+// unknown origin is charged as a national shipment.
+func Zone(fromPincode string, toPincode string) string {
+	for _, prefix := range SpecialPrefixes {
+		if len(toPincode) >= len(prefix) && toPincode[:len(prefix)] == prefix {
+			return ZoneSpecial
+		}
+	}
+	if !ValidPincode(fromPincode) {
+		return ZoneNational
+	}
+	if fromPincode[:3] == toPincode[:3] {
+		return ZoneLocal
+	}
+	if fromPincode[:2] == toPincode[:2] {
+		return ZoneRegional
+	}
+	return ZoneNational
+}
+
+// Calculate quotes a single parcel of the given weight in grams.
+func Calculate(fromPincode string, toPincode string, weight float64) (Quote, error) {
+	if !ValidPincode(toPincode) {
+		return Quote{}, errors.New(ErrorInvalidPincode)
+	}
+	zone := Zone(fromPincode, toPincode)
+	rate, ok := Rates[zone]
+	if !ok {
+		return Quote{}, fmt.Errorf("no shipping rate for zone %s", zone)
+	}
+
+	charge := rate.Base
+	if rate.SlabGrams > 0 && weight > rate.SlabGrams {
+		extraSlabs := math.Ceil((weight - rate.SlabGrams) / rate.SlabGrams)
+		charge += extraSlabs * rate.PerSlab
+	}
+	return Quote{Zone: zone, Weight: weight, Charge: charge}, nil
+}
+
+// ItemWeight is the shipping weight of quantity copies of a book weighing
+// bookWeight grams each.
+func ItemWeight(bookWeight float64, quantity int64) float64 {
+	if bookWeight <= 0 {
+		bookWeight = DefaultItemWeight
+	}
+	return bookWeight * float64(quantity)
+}
+
+// Item is one line of a quote: a book, who ships it and its total weight.
+type Item struct {
+	Book        string  `json:"book"`
+	Seller      string  `json:"seller"`
+	FromPincode string  `json:"-"`
+	Weight      float64 `json:"weight"`
+}
+
+// Shipment is the parcel a single seller sends for a set of items.
+type Shipment struct {
+	Seller string   `json:"seller"`
+	Books  []string `json:"books"`
+	Quote
+}
+
+// QuoteShipments groups the items by seller, since each seller ships their
+// books in one parcel, and quotes every parcel. It returns the shipments in
+// the order their sellers first appear along with the total charge.
+func QuoteShipments(items []Item, toPincode string) ([]Shipment, float64, error) {
+	var shipments []Shipment
+	index := map[string]int{}
+	origins := map[string]string{}
+	for _, item := range items {
+		i, ok := index[item.Seller]
+		if !ok {
+			i = len(shipments)
+			index[item.Seller] = i
+			origins[item.Seller] = item.FromPincode
+			shipments = append(shipments, Shipment{Seller: item.Seller})
+		}
+		shipments[i].Books = append(shipments[i].Books, item.Book)
+		shipments[i].Weight += item.Weight
+	}
+
+	var total float64
+	for i := range shipments {
+		quote, err := Calculate(origins[shipments[i].Seller], toPincode, shipments[i].Weight)
+		if err != nil {
+			return nil, 0, err
+		}
+		shipments[i].Quote = quote
+		total += quote.Charge
+	}
+	return shipments, total, nil
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrorBlobNotFound = errors.New("stored file not found")
+
+// BlobStore keeps uploaded files and hands out the public URL they are
+// served from.
+type BlobStore interface {
+	Put(key string, contentType string, body []byte) (string, error)
+	Get(key string) ([]byte, string, error)
+	Delete(key string) error
+	URL(key string) string
+	PresignPut(key string, contentType string, size int64, expires time.Duration) (PresignedPut, error)
+}
+
+var (
+	defaultStore BlobStore
+	defaultOnce  sync.Once
+)
+
+// DefaultStore picks the store from the environment: BLOB_STORE=s3 keeps
+// files in the S3_BUCKET bucket, anything else writes them under MEDIA_DIR.
+// MEDIA_BASE_URL, when set, is the public address files are served from
+// (a CDN in front of the bucket for instance).
+func DefaultStore() BlobStore {
+	defaultOnce.Do(func() {
+		baseURL := strings.TrimRight(os.Getenv("MEDIA_BASE_URL"), "/")
+		if os.Getenv("BLOB_STORE") == "s3" {
+			defaultStore = NewS3Store(os.Getenv("S3_BUCKET"), os.Getenv("AWS_REGION"), baseURL)
+			return
+		}
+		dir := os.Getenv("MEDIA_DIR")
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "media")
+		}
+		if baseURL == "" {
+			baseURL = "file://" + filepath.ToSlash(dir)
+		}
+		defaultStore = LocalStore{Dir: dir, BaseURL: baseURL}
+	})
+	return defaultStore
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+)
+
+var ErrorDamagedImage = errors.New("image data is damaged")
+
+// quality of the re-encoded original, higher than the variants as it is the
+// copy buyers zoom into
+const originalQuality = 92
+
+// CleanImage returns the copy of an upload that is actually published: the
+// same format, without the EXIF, GPS and other metadata cameras and phones
+// put in. JPEG and PNG are decoded and encoded again, a JPEG turned upright
+// first. A GIF keeps its image data as it is, only the metadata blocks are
+// dropped, as the standard library can't write animated GIFs faithfully.
+func CleanImage(contentType string, body []byte) ([]byte, error) {
+	var out bytes.Buffer
+	switch contentType {
+	case "image/jpeg":
+		src, err := decodeLimited(body)
+		if err != nil {
+			return nil, err
+		}
+		rgba := image.NewRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+		draw.Draw(rgba, rgba.Bounds(), src, src.Bounds().Min, draw.Src)
+		err = jpeg.Encode(&out, orient(rgba, jpegOrientation(body)), &jpeg.Options{Quality: originalQuality})
+		if err != nil {
+			return nil, err
+		}
+	case "image/png":
+		src, err := decodeLimited(body)
+		if err != nil {
+			return nil, err
+		}
+		if err := png.Encode(&out, src); err != nil {
+			return nil, err
+		}
+	case "image/gif":
+		if _, err := checkDimensions(body); err != nil {
+			return nil, err
+		}
+		return stripGIF(body)
+	default:
+		return nil, ErrorNotAnImage
+	}
+	return out.Bytes(), nil
+}
+
+// checkDimensions reads only the header of an image, so a small file that
+// would decode into gigabytes of pixels is turned down before decoding it.
+func checkDimensions(body []byte) (image.Config, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		return config, err
+	}
+	if config.Width <= 0 || config.Height <= 0 ||
+		int64(config.Width)*int64(config.Height) > MaxImagePixels {
+		return config, fmt.Errorf("image is larger than %d pixels", MaxImagePixels)
+	}
+	return config, nil
+}
+
+func decodeLimited(body []byte) (image.Image, error) {
+	if _, err := checkDimensions(body); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(bytes.NewReader(body))
+	return src, err
+}
+
+// stripGIF copies a GIF block by block, leaving out comments and
+// application extensions other than the one that makes it loop.
+func stripGIF(body []byte) ([]byte, error) {
+	if len(body) < 13 {
+		return nil, ErrorDamagedImage
+	}
+	i := 13
+	// global colour table
+	if body[10]&0x80 != 0 {
+		i += 3 << (body[10]&7 + 1)
+	}
+	if i > len(body) {
+		return nil, ErrorDamagedImage
+	}
+	out := append([]byte{}, body[:i]...)
+	for i < len(body) {
+		switch body[i] {
+		case 0x3B: // trailer
+			return append(out, 0x3B), nil
+		case 0x2C: // image descriptor, local colour table, LZW data
+			if i+11 > len(body) {
+				return nil, ErrorDamagedImage
+			}
+			start := i + 10
+			if body[i+9]&0x80 != 0 {
+				start += 3 << (body[i+9]&7 + 1)
+			}
+			end, err := skipSubBlocks(body, start+1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, body[i:end]...)
+			i = end
+		case 0x21: // extension
+			if i+2 > len(body) {
+				return nil, ErrorDamagedImage
+			}
+			end, err := skipSubBlocks(body, i+2)
+			if err != nil {
+				return nil, err
+			}
+			label := body[i+1]
+			looping := label == 0xFF && i+14 <= end &&
+				(string(body[i+3:i+14]) == "NETSCAPE2.0" || string(body[i+3:i+14]) == "ANIMEXTS1.0")
+			if label == 0xF9 || looping {
+				out = append(out, body[i:end]...)
+			}
+			i = end
+		default:
+			return nil, ErrorDamagedImage
+		}
+	}
+	return nil, ErrorDamagedImage
+}
+
+// skipSubBlocks returns the index just past the data sub-blocks starting at i.
+func skipSubBlocks(body []byte, i int) (int, error) {
+	for i < len(body) {
+		size := int(body[i])
+		i++
+		if size == 0 {
+			return i, nil
+		}
+		i += size
+	}
+	return 0, ErrorDamagedImage
+}
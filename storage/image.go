@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxImageSize is the largest image accepted, 5 MB unless MAX_IMAGE_BYTES
+// says otherwise.
+var MaxImageSize = int64(5 << 20)
+
+// MaxImagePixels is the largest width times height decoded, 40 megapixels
+// unless MAX_IMAGE_PIXELS says otherwise. It keeps a small, highly
+// compressed file from taking all of a lambda's memory once decoded.
+var MaxImagePixels = int64(40_000_000)
+
+// MaxImagesPerUpload caps the files sent in one upload request.
+const MaxImagesPerUpload = 10
+
+func init() {
+	if size, err := strconv.ParseInt(os.Getenv("MAX_IMAGE_BYTES"), 10, 64); err == nil && size > 0 {
+		MaxImageSize = size
+	}
+	if pixels, err := strconv.ParseInt(os.Getenv("MAX_IMAGE_PIXELS"), 10, 64); err == nil && pixels > 0 {
+		MaxImagePixels = pixels
+	}
+}
+
+// image types we accept, by their sniffed content type. WebP is left out:
+// there is no WebP encoder in Go without cgo, so its variants couldn't be
+// made in the format the upload came in.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+var (
+	ErrorImageEmpty = errors.New("image is empty")
+	ErrorNotAnImage = errors.New("file is not a JPEG, PNG or GIF image")
+)
+
+// SniffImage checks an upload from its content rather than the name or the
+// Content-Type the client sent, and returns the real content type.
+func SniffImage(body []byte) (string, error) {
+	if len(body) == 0 {
+		return "", ErrorImageEmpty
+	}
+	if int64(len(body)) > MaxImageSize {
+		return "", fmt.Errorf("image is larger than %d bytes", MaxImageSize)
+	}
+	contentType := http.DetectContentType(body)
+	if _, ok := imageExtensions[contentType]; !ok {
+		return "", ErrorNotAnImage
+	}
+	return contentType, nil
+}
+
+// ImageKey names a new image object, e.g. "book/617f1c.../63a2b9....jpg".
+func ImageKey(folder string, owner string, contentType string) string {
+	key := primitive.NewObjectID().Hex() + imageExtensions[contentType]
+	if owner != "" {
+		key = owner + "/" + key
+	}
+	return folder + "/" + key
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore keeps files on disk. It stands in for S3 when running offline.
+type LocalStore struct {
+	Dir     string
+	BaseURL string
+}
+
+func (l LocalStore) path(key string) string {
+	// keys never leave the store's folder
+	return filepath.Join(l.Dir, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func (l LocalStore) Put(key string, contentType string, body []byte) (string, error) {
+	file := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(file, body, 0644); err != nil {
+		return "", err
+	}
+	return l.URL(key), nil
+}
+
+func (l LocalStore) Get(key string) ([]byte, string, error) {
+	body, err := ioutil.ReadFile(l.path(key))
+	if os.IsNotExist(err) {
+		return nil, "", ErrorBlobNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return body, mime.TypeByExtension(path.Ext(key)), nil
+}
+
+func (l LocalStore) Delete(key string) error {
+	err := os.Remove(l.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (l LocalStore) URL(key string) string {
+	return strings.TrimRight(l.BaseURL, "/") + "/" + strings.TrimLeft(key, "/")
+}
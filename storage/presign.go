@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+var ErrorInvalidSignature = errors.New("upload link is invalid or has expired")
+
+// PresignedPut is where and how a client uploads a file straight to the
+// store, without going through API Gateway.
+type PresignedPut struct {
+	URL     string
+	Headers map[string]string
+}
+
+// PresignPut lets the client PUT the object itself. The size is part of the
+// signature, so S3 refuses a file of any other length. The object stays
+// private: it only becomes public once the upload is completed and the
+// checked, cleaned copy is written over it.
+func (s *S3Store) PresignPut(key string, contentType string, size int64, expires time.Duration) (PresignedPut, error) {
+	req, _ := s.client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:        aws.String(s.Bucket),
+		Key:           aws.String(key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+		ACL:           aws.String(s3.ObjectCannedACLPrivate),
+	})
+	signed, err := req.Presign(expires)
+	if err != nil {
+		return PresignedPut{}, err
+	}
+	return PresignedPut{URL: signed, Headers: map[string]string{
+		"Content-Type":   contentType,
+		"Content-Length": strconv.FormatInt(size, 10),
+		"x-amz-acl":      s3.ObjectCannedACLPrivate,
+	}}, nil
+}
+
+// PresignPut signs a link to the upload lambda's PUT upload/local/{key}
+// route, which writes into the local folder. It stands in for S3 pre-signed
+// URLs when running offline; LOCAL_UPLOAD_URL is where that route is served.
+func (l LocalStore) PresignPut(key string, contentType string, size int64, expires time.Duration) (PresignedPut, error) {
+	base := os.Getenv("LOCAL_UPLOAD_URL")
+	if base == "" {
+		base = "http://localhost:3000/upload/local"
+	}
+	expiresAt := time.Now().Add(expires).Unix()
+	query := url.Values{}
+	query.Set("size", strconv.FormatInt(size, 10))
+	query.Set("expires", strconv.FormatInt(expiresAt, 10))
+	query.Set("signature", localSignature(key, contentType, size, expiresAt))
+	return PresignedPut{
+		URL:     strings.TrimRight(base, "/") + "/" + key + "?" + query.Encode(),
+		Headers: map[string]string{"Content-Type": contentType},
+	}, nil
+}
+
+// VerifyLocalPut checks a request made with a link from LocalStore.PresignPut,
+// body being the file that was sent.
+func VerifyLocalPut(key string, contentType string, body []byte, size string, expires string, signature string) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return ErrorInvalidSignature
+	}
+	length, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || int64(len(body)) != length {
+		return ErrorInvalidSignature
+	}
+	expected := localSignature(key, contentType, length, expiresAt)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrorInvalidSignature
+	}
+	return nil
+}
+
+func localSignature(key string, contentType string, size int64, expiresAt int64) string {
+	secret := os.Getenv("UPLOAD_SIGNING_SECRET")
+	if secret == "" {
+		secret = "local-upload-secret"
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(key + "\n" + contentType + "\n" + strconv.FormatInt(size, 10) + "\n" + strconv.FormatInt(expiresAt, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"the-book-store/db"
+	"the-book-store/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RecordImage stores an uploaded image under key with its variants and keeps
+// a record of it in the image collection, which is how the URL is later
+// matched back to its variants and stored files. Only the copy CleanImage
+// makes is stored, so no upload publishes where a photo was taken, and an
+// image a client already put under key is replaced with it. A failure to
+// resize is logged but doesn't fail the upload; when the record can't be
+// written the stored files are deleted and the error returned.
+func RecordImage(store BlobStore, key string, owner string, contentType string, body []byte) (models.Image, error) {
+	body, err := CleanImage(contentType, body)
+	if err != nil {
+		return models.Image{}, err
+	}
+	if _, err := store.Put(key, contentType, body); err != nil {
+		return models.Image{}, err
+	}
+	variants, err := StoreVariants(store, key, body)
+	if err != nil {
+		fmt.Println(err, "COULD NOT MAKE IMAGE VARIANTS", key)
+	}
+	image := models.Image{
+		Key:         key,
+		URL:         store.URL(key),
+		ContentType: contentType,
+		Size:        int64(len(body)),
+		Profile:     owner,
+		Variants:    variants,
+		CreatedAt:   time.Now(),
+	}
+	// an image without a record can't be matched or deleted later, so the
+	// stored files go too
+	if _, err := db.DatabaseObj.Collection("image").InsertOne(context.Background(), image); err != nil {
+		fmt.Println(err, "COULD NOT RECORD IMAGE", key)
+		DeleteVariants(store, key)
+		store.Delete(key)
+		return models.Image{}, err
+	}
+	return image, nil
+}
+
+// FindImages looks up the upload records of image URLs. URLs that weren't
+// uploaded here are missing from the result.
+func FindImages(urls []string) (map[string]models.Image, error) {
+	images := map[string]models.Image{}
+	if len(urls) == 0 {
+		return images, nil
+	}
+	cur, err := db.DatabaseObj.Collection("image").Find(context.Background(), bson.M{"url": bson.M{"$in": urls}})
+	if err != nil {
+		return nil, err
+	}
+	var found []models.Image
+	if err := cur.All(context.Background(), &found); err != nil {
+		return nil, err
+	}
+	for _, image := range found {
+		images[image.URL] = image
+	}
+	return images, nil
+}
+
+// VariantsFor returns the variants of each image URL, in the same order.
+// URLs that weren't uploaded here have no variants and point at themselves.
+func VariantsFor(urls []string) []models.ImageVariants {
+	known, err := FindImages(urls)
+	if err != nil {
+		fmt.Println(err, "COULD NOT FETCH IMAGE VARIANTS")
+	}
+
+	variants := []models.ImageVariants{}
+	for _, url := range urls {
+		if image, ok := known[url]; ok && image.Variants.Original != "" {
+			variants = append(variants, image.Variants)
+		} else {
+			variants = append(variants, models.ImageVariants{Original: url, Full: url, Card: url, Thumb: url})
+		}
+	}
+	return variants
+}
+
+// DeleteImage removes an uploaded image, its variants and its record. URLs
+// that weren't uploaded here are left alone.
+func DeleteImage(store BlobStore, url string) error {
+	var image models.Image
+	err := db.DatabaseObj.Collection("image").FindOneAndDelete(context.Background(), bson.M{"url": url}).Decode(&image)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	DeleteVariants(store, image.Key)
+	return store.Delete(image.Key)
+}
+
+// ForgetImage removes the record of the image stored under key but keeps its
+// files, for a caller that records the same key again once it retries.
+func ForgetImage(key string) error {
+	_, err := db.DatabaseObj.Collection("image").DeleteOne(context.Background(), bson.M{"key": key})
+	return err
+}
+
+// VariantsOf is VariantsFor a single URL, nil when there is no URL.
+func VariantsOf(url string) *models.ImageVariants {
+	if url == "" {
+		return nil
+	}
+	return &VariantsFor([]string{url})[0]
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3Store keeps files in an S3 bucket. Objects are public-read so the URLs
+// can go straight into <img> tags.
+type S3Store struct {
+	Bucket  string
+	Region  string
+	BaseURL string
+	client  *s3.S3
+}
+
+func NewS3Store(bucket string, region string, baseURL string) *S3Store {
+	if region == "" {
+		region = "ap-south-1"
+	}
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, region)
+	}
+	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String(region)}))
+	return &S3Store{Bucket: bucket, Region: region, BaseURL: baseURL, client: s3.New(sess)}
+}
+
+func (s *S3Store) Put(key string, contentType string, body []byte) (string, error) {
+	_, err := s.client.PutObject(&s3.PutObjectInput{
+		Bucket:       aws.String(s.Bucket),
+		Key:          aws.String(key),
+		Body:         bytes.NewReader(body),
+		ContentType:  aws.String(contentType),
+		ACL:          aws.String(s3.ObjectCannedACLPublicRead),
+		CacheControl: aws.String("public, max-age=31536000, immutable"),
+	})
+	if err != nil {
+		return "", err
+	}
+	return s.URL(key), nil
+}
+
+func (s *S3Store) Get(key string) ([]byte, string, error) {
+	out, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, "", ErrorBlobNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	defer out.Body.Close()
+	body, err := ioutil.ReadAll(out.Body)
+	return body, aws.StringValue(out.ContentType), err
+}
+
+func (s *S3Store) Delete(key string) error {
+	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (s *S3Store) URL(key string) string {
+	return strings.TrimRight(s.BaseURL, "/") + "/" + strings.TrimLeft(key, "/")
+}
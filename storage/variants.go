@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"path"
+	"strings"
+
+	// decoders for image.Decode
+	_ "image/gif"
+	_ "image/png"
+
+	"the-book-store/models"
+)
+
+// Variant is a resized copy of an uploaded image, no larger than MaxSize
+// pixels on its longest side.
+type Variant struct {
+	Name    string
+	MaxSize int
+}
+
+// Variants go from largest to smallest, each is resized from the previous
+// one which keeps the work down on big phone photos.
+var Variants = []Variant{
+	{"full", 1600},
+	{"card", 480},
+	{"thumb", 160},
+}
+
+const variantQuality = 82
+
+// MakeVariants decodes an image and re-encodes it at each variant size as
+// JPEG. Re-encoding also drops EXIF and any other metadata, after the
+// orientation it carried has been applied. Uploads are limited to JPEG, PNG
+// and GIF, so every stored image gets all of its variants.
+func MakeVariants(body []byte) (map[string][]byte, error) {
+	src, err := decodeLimited(body)
+	if err != nil {
+		return nil, err
+	}
+	// draw onto white so transparent PNG/GIF pixels don't turn black in JPEG
+	rgba := image.NewRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(rgba, rgba.Bounds(), src, src.Bounds().Min, draw.Over)
+	current := orient(rgba, jpegOrientation(body))
+
+	variants := map[string][]byte{}
+	for _, variant := range Variants {
+		current = shrink(current, variant.MaxSize)
+		var out bytes.Buffer
+		if err := jpeg.Encode(&out, current, &jpeg.Options{Quality: variantQuality}); err != nil {
+			return nil, err
+		}
+		variants[variant.Name] = out.Bytes()
+	}
+	return variants, nil
+}
+
+// shrink scales an image down so its longest side is at most maxSize,
+// averaging the source pixels each target pixel covers. Smaller images are
+// returned untouched, they are never scaled up.
+func shrink(src *image.RGBA, maxSize int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if w <= maxSize && h <= maxSize {
+		return src
+	}
+	dw, dh := maxSize, h*maxSize/w
+	if h > w {
+		dw, dh = w*maxSize/h, maxSize
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, (y+1)*h/dh
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, (x+1)*w/dw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(src.Rect.Min.X+x0, src.Rect.Min.Y+sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[i])
+					g += int(src.Pix[i+1])
+					b += int(src.Pix[i+2])
+					a += int(src.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+			d := dst.PixOffset(x, y)
+			dst.Pix[d] = uint8(r / n)
+			dst.Pix[d+1] = uint8(g / n)
+			dst.Pix[d+2] = uint8(b / n)
+			dst.Pix[d+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// variantKey names a variant next to its original,
+// "book/p/abc.png" -> "book/p/abc_thumb.jpg".
+func variantKey(key string, name string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + "_" + name + ".jpg"
+}
+
+// StoreVariants makes and stores the variants of an image that was stored
+// under key. When the image can't be resized every variant points at the
+// original, so callers can always use them.
+func StoreVariants(store BlobStore, key string, body []byte) (models.ImageVariants, error) {
+	original := store.URL(key)
+	variants := models.ImageVariants{Original: original, Full: original, Card: original, Thumb: original}
+	resized, err := MakeVariants(body)
+	if err != nil {
+		return variants, err
+	}
+	for _, variant := range Variants {
+		url, err := store.Put(variantKey(key, variant.Name), "image/jpeg", resized[variant.Name])
+		if err != nil {
+			return variants, err
+		}
+		switch variant.Name {
+		case "full":
+			variants.Full = url
+		case "card":
+			variants.Card = url
+		case "thumb":
+			variants.Thumb = url
+		}
+	}
+	return variants, nil
+}
+
+// DeleteVariants removes the stored variants of an original image.
+func DeleteVariants(store BlobStore, key string) {
+	for _, variant := range Variants {
+		store.Delete(variantKey(key, variant.Name))
+	}
+}
@@ -0,0 +1,75 @@
+package tax
+
+import (
+	"math"
+	"strings"
+
+	"the-book-store/models"
+)
+
+const (
+	ClassPrintedBook = "PRINTED_BOOK"
+	ClassEbook       = "EBOOK"
+	ClassStationery  = "STATIONERY"
+)
+
+// Rates holds the GST rate, in percent, of every tax class.
+var Rates = map[string]float64{
+	ClassPrintedBook: 0,
+	ClassEbook:       18,
+	ClassStationery:  12,
+}
+
+// ClassOf works out the tax class of a listing from its category and book
+// type; anything that is not an e-book or stationery is a printed book.
+func ClassOf(book models.Book) string {
+	category := normalize(book.Category)
+	bookType := normalize(book.BookType)
+	if strings.Contains(category, "stationery") || strings.Contains(bookType, "stationery") {
+		return ClassStationery
+	}
+	for _, digital := range []string{"ebook", "kindle", "digital", "pdf"} {
+		if strings.Contains(bookType, digital) {
+			return ClassEbook
+		}
+	}
+	return ClassPrintedBook
+}
+
+// Compute splits a GST inclusive amount into its taxable value and tax. A
+// sale within one state pays CGST and SGST in equal halves, a sale across
+// states (or where either state is unknown) pays IGST.
+func Compute(amount float64, class string, sellerState string, buyerState string) models.TaxBreakdown {
+	rate := Rates[class]
+	taxable := round(amount * 100 / (100 + rate))
+	total := round(amount - taxable)
+
+	breakdown := models.TaxBreakdown{
+		Class:        class,
+		Rate:         rate,
+		TaxableValue: taxable,
+		Total:        total,
+	}
+	if IntraState(sellerState, buyerState) {
+		breakdown.CGST = round(total / 2)
+		breakdown.SGST = round(total - breakdown.CGST)
+	} else {
+		breakdown.IGST = total
+	}
+	return breakdown
+}
+
+// IntraState reports whether seller and buyer are known to be in the same state.
+func IntraState(sellerState string, buyerState string) bool {
+	seller := normalize(sellerState)
+	return seller != "" && seller == normalize(buyerState)
+}
+
+func normalize(s string) string {
+	s = strings.ToLower(s)
+	return strings.NewReplacer(" ", "", "-", "", "_", "").Replace(s)
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}